@@ -0,0 +1,208 @@
+package cachechain
+
+import (
+	"encoding/json"
+	"github.com/graymonster0927/component/cachechain/cache"
+	"net/http"
+)
+
+type AdminHandlerOption func(*adminOptions)
+
+type adminOptions struct {
+	auth func(r *http.Request) bool
+}
+
+// WithAdminAuth 鉴权, 返回 false 时拒绝请求
+func WithAdminAuth(auth func(r *http.Request) bool) AdminHandlerOption {
+	return func(o *adminOptions) {
+		o.auth = auth
+	}
+}
+
+type AdminTier struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Version bool   `json:"version"`
+	Tag     bool   `json:"tag"`
+	Peek    bool   `json:"peek"`
+	//Size 缓存的 key 数, -1 表示不支持
+	Size int    `json:"size"`
+	Hit  uint64 `json:"hit"`
+	Miss uint64 `json:"miss"`
+	Err  uint64 `json:"err"`
+}
+
+type AdminPeek struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Exist   bool   `json:"exist"`
+	Filling bool   `json:"filling"`
+	Err     string `json:"err,omitempty"`
+}
+
+type AdminFillToken struct {
+	Index     int               `json:"index"`
+	Name      string            `json:"name"`
+	TokenList []cache.FillToken `json:"token_list"`
+}
+
+type adminResponse struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// AdminHandler 运行时查看缓存链
+//
+//	GET  /tiers             各缓存层及读取统计
+//	GET  /peek?key=xx       各缓存层中的值, 不回源
+//	POST /clear?key=xx      清除 key
+//	POST /clear_tag?tag=xx  按标签清除
+//	GET  /fill_tokens       当前进程正在回源的 token
+//
+// 挂在子路径下时配合 http.StripPrefix 使用
+type AdminHandler struct {
+	chain *Chain
+	opts  adminOptions
+	mux   *http.ServeMux
+}
+
+func NewAdminHandler(chain *Chain, opts ...AdminHandlerOption) *AdminHandler {
+	op := adminOptions{}
+	for _, option := range opts {
+		option(&op)
+	}
+	h := &AdminHandler{
+		chain: chain,
+		opts:  op,
+		mux:   http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/tiers", h.method(http.MethodGet, h.tiers))
+	h.mux.HandleFunc("/peek", h.method(http.MethodGet, h.peek))
+	h.mux.HandleFunc("/clear", h.method(http.MethodPost, h.clear))
+	h.mux.HandleFunc("/clear_tag", h.method(http.MethodPost, h.clearTag))
+	h.mux.HandleFunc("/fill_tokens", h.method(http.MethodGet, h.fillTokens))
+	return h
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.auth != nil && !h.opts.auth(r) {
+		writeAdminResponse(w, http.StatusForbidden, adminResponse{Error: "forbidden"})
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) method(method string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeAdminResponse(w, http.StatusMethodNotAllowed, adminResponse{Error: "method not allowed"})
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func (h *AdminHandler) tiers(w http.ResponseWriter, r *http.Request) {
+	tierList := make([]AdminTier, 0, len(h.chain.cacheList))
+	for idx, c := range h.chain.cacheList {
+		tier := AdminTier{
+			Index: idx,
+			Name:  c.GetName(),
+			Size:  -1,
+			Hit:   h.chain.statsList[idx].hit.Load(),
+			Miss:  h.chain.statsList[idx].miss.Load(),
+			Err:   h.chain.statsList[idx].err.Load(),
+		}
+		_, tier.Version = cache.As[cache.VersionCacheInterface](c)
+		_, tier.Tag = cache.AsTagCache(c)
+		_, tier.Peek = cache.As[cache.InspectInterface](c)
+		if sizer, ok := cache.As[interface{ Len() int }](c); ok {
+			tier.Size = sizer.Len()
+		}
+		tierList = append(tierList, tier)
+	}
+	writeAdminResponse(w, http.StatusOK, adminResponse{Data: tierList})
+}
+
+func (h *AdminHandler) peek(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeAdminResponse(w, http.StatusBadRequest, adminResponse{Error: "key is required"})
+		return
+	}
+	peekList := make([]AdminPeek, 0, len(h.chain.cacheList))
+	for idx, c := range h.chain.cacheList {
+		item := AdminPeek{
+			Index: idx,
+			Name:  c.GetName(),
+		}
+		inspect, ok := cache.As[cache.InspectInterface](c)
+		if !ok {
+			item.Err = "peek not support"
+			peekList = append(peekList, item)
+			continue
+		}
+		peekRet := inspect.Peek(r.Context(), key)
+		item.Value = peekRet.Value
+		item.Exist = peekRet.Exist
+		item.Filling = peekRet.Filling
+		if !peekRet.IsSuccess() {
+			item.Err = peekRet.Err.Error()
+		}
+		peekList = append(peekList, item)
+	}
+	writeAdminResponse(w, http.StatusOK, adminResponse{Data: peekList})
+}
+
+func (h *AdminHandler) clear(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeAdminResponse(w, http.StatusBadRequest, adminResponse{Error: "key is required"})
+		return
+	}
+	clearRet := h.chain.Clear(r.Context(), key)
+	if !clearRet.IsSuccess() {
+		writeAdminResponse(w, http.StatusInternalServerError, adminResponse{Error: clearRet.Err.Error()})
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, adminResponse{Data: key})
+}
+
+func (h *AdminHandler) clearTag(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeAdminResponse(w, http.StatusBadRequest, adminResponse{Error: "tag is required"})
+		return
+	}
+	clearRet := h.chain.ClearByTag(r.Context(), tag)
+	resp := adminResponse{Data: map[string]int{"clear_count": clearRet.ClearCount}}
+	if !clearRet.IsSuccess() {
+		resp.Error = clearRet.Err.Error()
+		writeAdminResponse(w, http.StatusInternalServerError, resp)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) fillTokens(w http.ResponseWriter, r *http.Request) {
+	tokenList := make([]AdminFillToken, 0)
+	for idx, c := range h.chain.cacheList {
+		fillToken, ok := cache.As[cache.FillTokenInterface](c)
+		if !ok {
+			continue
+		}
+		tokenList = append(tokenList, AdminFillToken{
+			Index:     idx,
+			Name:      c.GetName(),
+			TokenList: fillToken.GetFillTokenList(),
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, adminResponse{Data: tokenList})
+}
+
+func writeAdminResponse(w http.ResponseWriter, status int, resp adminResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,372 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component/cachechain/cacheerr"
+	"github.com/graymonster0927/component/cachechain/helper"
+	"io"
+	"strings"
+)
+
+// compressMagic 压缩值的前缀, 后面跟一个字节标识算法
+// 以 \x00\xff 开头的值不是合法的 utf-8, 不会和已有的未压缩值冲突, 不带前缀的值都按原始值读取
+const compressMagic = "\x00\xffgmz"
+
+const (
+	// CompressHeaderRaw 未压缩, 原始值本身以 compressMagic 开头时才会加上
+	CompressHeaderRaw byte = 0x00
+	// CompressHeaderGzip gzip 压缩
+	CompressHeaderGzip byte = 0x01
+	// CompressHeaderFlate flate 压缩
+	CompressHeaderFlate byte = 0x02
+)
+
+// Compressor 压缩算法, 可自行实现 zstd/snappy 等
+type Compressor interface {
+	// Header 写在前缀后面的一个字节, 不能为 0x00 且不同算法不能重复
+	Header() byte
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+type GzipCompressor struct {
+	Level int
+}
+
+func (g *GzipCompressor) Header() byte {
+	return CompressHeaderGzip
+}
+
+func (g *GzipCompressor) Compress(src []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *GzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type FlateCompressor struct {
+	Level int
+}
+
+func (f *FlateCompressor) Header() byte {
+	return CompressHeaderFlate
+}
+
+func (f *FlateCompressor) Compress(src []byte) ([]byte, error) {
+	level := f.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *FlateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type CompressCacheOption func(*compressOptions)
+
+type compressOptions struct {
+	threshold    int
+	compressor   Compressor
+	decompressor map[byte]Compressor
+}
+
+// WithCompressThreshold 值的长度大于等于 threshold 才压缩, 小于 0 表示只解压不压缩(用于灰度回滚)
+func WithCompressThreshold(threshold int) CompressCacheOption {
+	return func(o *compressOptions) {
+		o.threshold = threshold
+	}
+}
+
+// WithCompressor 写入时使用的压缩算法, 传 nil 表示只解压不压缩
+func WithCompressor(compressor Compressor) CompressCacheOption {
+	return func(o *compressOptions) {
+		o.compressor = compressor
+	}
+}
+
+// WithDecompressor 额外支持读取的压缩算法, 切换算法期间旧数据仍可读
+func WithDecompressor(compressor Compressor) CompressCacheOption {
+	return func(o *compressOptions) {
+		if compressor == nil {
+			return
+		}
+		o.decompressor[compressor.Header()] = compressor
+	}
+}
+
+// CompressCache 给任意缓存加上压缩, 压缩后的值以 compressMagic 加一个字节标识算法
+// 不带前缀的值按原始值读取, 因此压缩和未压缩的值可以共存
+// 压缩失败时统一返回 HandleErrStrategyBreak, 中断整条链的写入
+type CompressCache struct {
+	CacheInterface
+	opts compressOptions
+}
+
+type compressVersionCache struct {
+	*CompressCache
+	version VersionCacheInterface
+}
+
+// NewCompressCache 被包装的缓存支持版本号时返回值同样支持版本号
+func NewCompressCache(cache CacheInterface, opts ...CompressCacheOption) CacheInterface {
+	gzipCompressor := &GzipCompressor{}
+	flateCompressor := &FlateCompressor{}
+	op := compressOptions{
+		threshold:  1024,
+		compressor: gzipCompressor,
+		decompressor: map[byte]Compressor{
+			gzipCompressor.Header():  gzipCompressor,
+			flateCompressor.Header(): flateCompressor,
+		},
+	}
+	for _, option := range opts {
+		option(&op)
+	}
+	if op.compressor != nil {
+		op.decompressor[op.compressor.Header()] = op.compressor
+	}
+
+	compressCache := &CompressCache{
+		CacheInterface: cache,
+		opts:           op,
+	}
+	if v, ok := cache.(VersionCacheInterface); ok {
+		return &compressVersionCache{
+			CompressCache: compressCache,
+			version:       v,
+		}
+	}
+	return compressCache
+}
+
+func (c *CompressCache) Unwrap() CacheInterface {
+	return c.CacheInterface
+}
+
+func (c *CompressCache) SetFnGetNoCache(fn func(c context.Context, key string) (string, error)) {
+	//回源的值由被包装的缓存写入, 这里先压缩
+	c.CacheInterface.SetFnGetNoCache(func(ctx context.Context, key string) (string, error) {
+		val, err := fn(ctx, key)
+		if err != nil {
+			return val, err
+		}
+		return c.compress(val)
+	})
+}
+
+func (c *CompressCache) SetFnBatchGetNoCache(fn func(c context.Context, keyList []string) (map[string]string, error)) {
+	c.CacheInterface.SetFnBatchGetNoCache(func(ctx context.Context, keyList []string) (map[string]string, error) {
+		valMap, err := fn(ctx, keyList)
+		if err != nil {
+			return valMap, err
+		}
+		retMap := make(map[string]string, len(valMap))
+		for key, val := range valMap {
+			if retMap[key], err = c.compress(val); err != nil {
+				return nil, err
+			}
+		}
+		return retMap, nil
+	})
+}
+
+func (c *CompressCache) GetFromCache(ctx context.Context, key string) GetCacheResult {
+	return c.decompressGetResult(c.CacheInterface.GetFromCache(ctx, key))
+}
+
+func (c *CompressCache) BatchGetFromCache(ctx context.Context, keyList []string) map[string]GetCacheResult {
+	retMap := c.CacheInterface.BatchGetFromCache(ctx, keyList)
+	for key, ret := range retMap {
+		retMap[key] = c.decompressGetResult(ret)
+	}
+	return retMap
+}
+
+func (c *CompressCache) RetryGetFromCache(ctx context.Context, key string) GetCacheResult {
+	return c.decompressGetResult(c.CacheInterface.RetryGetFromCache(ctx, key))
+}
+
+func (c *CompressCache) SetCache(ctx context.Context, key string, val string) SetCacheResult {
+	compressed, err := c.compress(val)
+	if err != nil {
+		return SetCacheResult{
+			ErrHelper:         helper.ErrHelper{Err: err},
+			HandleErrStrategy: HandleErrStrategyBreak,
+		}
+	}
+	return c.CacheInterface.SetCache(ctx, key, compressed)
+}
+
+func (c *CompressCache) BatchSetCache(ctx context.Context, keyList []string, valList []string) map[string]SetCacheResult {
+	compressedList := make([]string, len(valList))
+	for idx, val := range valList {
+		compressed, err := c.compress(val)
+		if err != nil {
+			retMap := make(map[string]SetCacheResult, len(keyList))
+			for _, key := range keyList {
+				retMap[key] = SetCacheResult{
+					ErrHelper:         helper.ErrHelper{Err: err},
+					HandleErrStrategy: HandleErrStrategyBreak,
+				}
+			}
+			return retMap
+		}
+		compressedList[idx] = compressed
+	}
+	return c.CacheInterface.BatchSetCache(ctx, keyList, compressedList)
+}
+
+func (c *CompressCache) RetrySetCache(ctx context.Context, key string, val string) SetCacheResult {
+	compressed, err := c.compress(val)
+	if err != nil {
+		return SetCacheResult{
+			ErrHelper:         helper.ErrHelper{Err: err},
+			HandleErrStrategy: HandleErrStrategyBreak,
+		}
+	}
+	return c.CacheInterface.RetrySetCache(ctx, key, compressed)
+}
+
+func (c *CompressCache) Peek(ctx context.Context, key string) PeekCacheResult {
+	inspect, ok := c.CacheInterface.(InspectInterface)
+	if !ok {
+		return PeekCacheResult{
+			ErrHelper: helper.ErrHelper{Err: cacheerr.InspectNotSupport},
+		}
+	}
+	ret := inspect.Peek(ctx, key)
+	if !ret.IsSuccess() || !ret.Exist {
+		return ret
+	}
+	ret.Value, ret.Err = c.decompress(ret.Value)
+	return ret
+}
+
+func (c *compressVersionCache) GetWithVersion(ctx context.Context, key string) GetVersionCacheResult {
+	ret := c.version.GetWithVersion(ctx, key)
+	if !ret.IsSuccess() || !ret.Exist {
+		return ret
+	}
+	val, err := c.decompress(ret.Value)
+	if err != nil {
+		ret.Err = err
+		ret.Exist = false
+		ret.Value = ""
+		return ret
+	}
+	ret.Value = val
+	return ret
+}
+
+func (c *compressVersionCache) CompareAndSet(ctx context.Context, key string, expectedVersion int64, val string) CasCacheResult {
+	compressed, err := c.compress(val)
+	if err != nil {
+		return CasCacheResult{
+			ErrHelper:         helper.ErrHelper{Err: err},
+			HandleErrStrategy: HandleErrStrategyBreak,
+		}
+	}
+	return c.version.CompareAndSet(ctx, key, expectedVersion, compressed)
+}
+
+func (c *compressVersionCache) SetWithVersion(ctx context.Context, key string, val string, version int64) SetCacheResult {
+	compressed, err := c.compress(val)
+	if err != nil {
+		return SetCacheResult{
+			ErrHelper:         helper.ErrHelper{Err: err},
+			HandleErrStrategy: HandleErrStrategyBreak,
+		}
+	}
+	return c.version.SetWithVersion(ctx, key, compressed, version)
+}
+
+func (c *CompressCache) decompressGetResult(ret GetCacheResult) GetCacheResult {
+	if !ret.IsSuccess() || !ret.Exist {
+		return ret
+	}
+	val, err := c.decompress(ret.Value)
+	if err != nil {
+		ret.Err = err
+		ret.Exist = false
+		ret.Value = ""
+		return ret
+	}
+	ret.Value = val
+	return ret
+}
+
+func (c *CompressCache) compress(val string) (string, error) {
+	if c.opts.compressor == nil || c.opts.threshold < 0 || len(val) < c.opts.threshold {
+		if strings.HasPrefix(val, compressMagic) {
+			//原始值以前缀开头 加上头字节避免误解压
+			return compressMagic + string(CompressHeaderRaw) + val, nil
+		}
+		return val, nil
+	}
+	compressed, err := c.opts.compressor.Compress([]byte(val))
+	if err != nil {
+		return "", err
+	}
+	return compressMagic + string(c.opts.compressor.Header()) + string(compressed), nil
+}
+
+func (c *CompressCache) decompress(val string) (string, error) {
+	if !strings.HasPrefix(val, compressMagic) || len(val) == len(compressMagic) {
+		return val, nil
+	}
+	header := val[len(compressMagic)]
+	body := val[len(compressMagic)+1:]
+	if header == CompressHeaderRaw {
+		return body, nil
+	}
+	compressor, ok := c.opts.decompressor[header]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("compress header %#x not support", header))
+	}
+	decompressed, err := compressor.Decompress([]byte(body))
+	if err != nil {
+		return "", err
+	}
+	return string(decompressed), nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompressCache_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryCache()
+	compressCache := NewCompressCache(memory, WithCompressThreshold(16))
+
+	large := strings.Repeat("{\"name\":\"graymonster\"}", 100)
+	for _, val := range []string{"small", large, "\n\t{}", compressMagic + "a"} {
+		compressCache.SetCache(ctx, "k", val)
+		getRet := compressCache.GetFromCache(ctx, "k")
+		if !getRet.IsSuccess() || getRet.Value != val {
+			t.Fatalf("Expected %q, got %+v", val, getRet)
+		}
+	}
+
+	raw := memory.GetFromCache(ctx, "k")
+	if raw.Value != compressMagic+string(CompressHeaderRaw)+compressMagic+"a" {
+		t.Errorf("Expected raw header for value with magic prefix, got %q", raw.Value)
+	}
+
+	compressCache.SetCache(ctx, "k", large)
+	raw = memory.GetFromCache(ctx, "k")
+	if !strings.HasPrefix(raw.Value, compressMagic+string(CompressHeaderGzip)) || len(raw.Value) >= len(large) {
+		t.Errorf("Expected gzip compressed value, got length %d", len(raw.Value))
+	}
+}
+
+func TestCompressCache_ReadUncompressed(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryCache()
+	compressCache := NewCompressCache(memory, WithCompressor(&FlateCompressor{}))
+	//旧值以保留字节开头也按原始值读取
+	for _, legacy := range []string{"legacy value", "\n{\"a\":1}", "\x01\x02"} {
+		memory.SetCache(ctx, "k", legacy)
+		getRet := compressCache.GetFromCache(ctx, "k")
+		if !getRet.IsSuccess() || getRet.Value != legacy {
+			t.Errorf("Expected %q, got %+v", legacy, getRet)
+		}
+	}
+
+	//不压缩时仍可读取压缩值
+	readOnly := NewCompressCache(memory, WithCompressor(nil), WithCompressThreshold(1))
+	compressCache.SetCache(ctx, "k", strings.Repeat("a", 2048))
+	if getRet := readOnly.GetFromCache(ctx, "k"); getRet.Value != strings.Repeat("a", 2048) {
+		t.Errorf("Expected decompressed value, got %+v", getRet)
+	}
+	readOnly.SetCache(ctx, "k", "abc")
+	if raw := memory.GetFromCache(ctx, "k"); raw.Value != "abc" {
+		t.Errorf("Expected uncompressed value, got %q", raw.Value)
+	}
+
+	if _, ok := compressCache.(VersionCacheInterface); !ok {
+		t.Errorf("Expected version support passed through")
+	}
+}
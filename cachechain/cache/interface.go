@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"github.com/graymonster0927/component/cachechain/helper"
+	"time"
 )
 
 //值
@@ -31,6 +32,8 @@ const (
 type GetCacheResult struct {
 	Value string
 	Exist bool
+	//Filled 缓存中没有, 值是这次回源得到的
+	Filled bool
 	helper.ErrHelper
 	HandleErrStrategy HandleErrStrategy
 }
@@ -60,3 +63,95 @@ type CacheInterface interface {
 	SetFnBatchGetNoCache(fn func(c context.Context, keyList []string) (map[string]string, error))
 	SetKeyPrefix(keyPrefix string)
 }
+
+type GetVersionCacheResult struct {
+	Value   string
+	Exist   bool
+	Version int64
+	helper.ErrHelper
+	HandleErrStrategy HandleErrStrategy
+}
+
+type CasCacheResult struct {
+	//Swapped 是否写入成功
+	Swapped bool
+	//Version 写入成功时为新版本号, 失败时为当前版本号
+	Version int64
+	helper.ErrHelper
+	HandleErrStrategy HandleErrStrategy
+}
+
+// VersionCacheInterface 支持版本号的缓存, 值和版本号一起存储, 用于跨进程安全的 读-改-写
+type VersionCacheInterface interface {
+	GetWithVersion(ctx context.Context, key string) GetVersionCacheResult
+	CompareAndSet(ctx context.Context, key string, expectedVersion int64, val string) CasCacheResult
+	//SetWithVersion 用下层缓存的值和版本号回填, 已有值时版本号不会回退
+	SetWithVersion(ctx context.Context, key string, val string, version int64) SetCacheResult
+}
+
+type TagKeysResult struct {
+	KeyList []string
+	//Cursor 传给下一次 GetTagKeys, 为空表示已取完
+	Cursor string
+	helper.ErrHelper
+	HandleErrStrategy HandleErrStrategy
+}
+
+// TagCacheInterface 支持按标签维护 key 索引的缓存, 用于按标签批量清除
+type TagCacheInterface interface {
+	AddTag(ctx context.Context, key string, tagList []string) SetCacheResult
+	//GetTagKeys 从 cursor 开始取标签下大约 count 个 key, cursor 为空表示从头开始
+	//遍历期间一直在标签中的 key 至少返回一次, 可能返回重复的 key
+	GetTagKeys(ctx context.Context, tag string, cursor string, count int) TagKeysResult
+	RemoveTagKeys(ctx context.Context, tag string, keyList []string) ClearCacheResult
+}
+
+// WrapperInterface 包装了其他缓存的缓存, 比如 CompressCache
+type WrapperInterface interface {
+	Unwrap() CacheInterface
+}
+
+// As 取出实现了 T 的缓存, 会穿过包装层
+func As[T any](cache CacheInterface) (T, bool) {
+	for cache != nil {
+		if v, ok := cache.(T); ok {
+			return v, true
+		}
+		wrapper, ok := cache.(WrapperInterface)
+		if !ok {
+			break
+		}
+		cache = wrapper.Unwrap()
+	}
+	var empty T
+	return empty, false
+}
+
+// AsTagCache 取出支持标签的缓存, 会穿过包装层
+func AsTagCache(cache CacheInterface) (TagCacheInterface, bool) {
+	return As[TagCacheInterface](cache)
+}
+
+type PeekCacheResult struct {
+	Value string
+	Exist bool
+	//Filling 有请求拿着 token 正在回源
+	Filling bool
+	helper.ErrHelper
+}
+
+// InspectInterface 只读查看缓存中的值, 不回源也不占用回源 token
+type InspectInterface interface {
+	Peek(ctx context.Context, key string) PeekCacheResult
+}
+
+type FillToken struct {
+	Key     string    `json:"key"`
+	Token   string    `json:"token"`
+	StartAt time.Time `json:"start_at"`
+}
+
+// FillTokenInterface 查看当前进程中正在回源的 token
+type FillTokenInterface interface {
+	GetFillTokenList() []FillToken
+}
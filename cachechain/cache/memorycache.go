@@ -0,0 +1,422 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component/cachechain/cacheerr"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryTagSweepInterval AddTag 时最多每隔这个时间清理一次标签索引
+// memoryTagGrace 加了标签还没写入值的 key 在索引中最多保留的时间
+const (
+	memoryTagSweepInterval = time.Minute
+	memoryTagGrace         = time.Minute
+)
+
+type memoryEntry struct {
+	value string
+	//exist 为 false 说明已被清除, 只保留版本号
+	exist    bool
+	version  int64
+	expireAt time.Time
+}
+
+func (e *memoryEntry) isExpired(now time.Time) bool {
+	return !e.expireAt.IsZero() && e.expireAt.Before(now)
+}
+
+type MemoryCacheOption func(*memoryOptions)
+
+type memoryOptions struct {
+	expireTime int
+	strategy   HandleErrStrategy
+}
+
+func WithMemoryExpireTime(expireTime int) MemoryCacheOption {
+	return func(o *memoryOptions) {
+		o.expireTime = expireTime
+	}
+}
+
+func WithMemoryHandleErrStrategy(strategy HandleErrStrategy) MemoryCacheOption {
+	return func(o *memoryOptions) {
+		o.strategy = strategy
+	}
+}
+
+// memoryTaggedKey 反向索引, 值过期或清除时从标签中删掉
+type memoryTaggedKey struct {
+	tagKeySet map[string]struct{}
+	taggedAt  time.Time
+}
+
+// MemoryCache 进程内缓存, 一般放在 redis 前面
+// 未命中时返回 cacheerr.CacheMiss, 由链上的下一层缓存处理, 自身不回源
+// 值过期或清除后标签随之删除, 重新写入后需要再 SetWithTags 才能按标签清除
+type MemoryCache struct {
+	opts      memoryOptions
+	lock      sync.Mutex
+	data      map[string]*memoryEntry
+	tags      map[string]map[string]struct{}
+	keyTags   map[string]*memoryTaggedKey
+	lastSweep time.Time
+	keyPrefix string
+}
+
+func NewMemoryCache(opts ...MemoryCacheOption) *MemoryCache {
+	op := memoryOptions{
+		expireTime: 60,
+		strategy:   HandleErrStrategyContinue,
+	}
+	for _, option := range opts {
+		option(&op)
+	}
+	return &MemoryCache{
+		opts:    op,
+		data:    make(map[string]*memoryEntry),
+		tags:    make(map[string]map[string]struct{}),
+		keyTags: make(map[string]*memoryTaggedKey),
+	}
+}
+
+func (m *MemoryCache) GetName() string {
+	return reflect.TypeOf(m).String()
+}
+
+func (m *MemoryCache) SetFnGetNoCache(fn func(c context.Context, key string) (string, error)) {
+	//内存缓存不回源
+}
+
+func (m *MemoryCache) SetFnBatchGetNoCache(fn func(c context.Context, keyList []string) (map[string]string, error)) {
+	//内存缓存不回源
+}
+
+func (m *MemoryCache) SetKeyPrefix(keyPrefix string) {
+	m.keyPrefix = keyPrefix
+}
+
+func (m *MemoryCache) GetFromCache(ctx context.Context, key string) GetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.get(key)
+}
+
+func (m *MemoryCache) BatchGetFromCache(ctx context.Context, keyList []string) map[string]GetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	retMap := make(map[string]GetCacheResult, len(keyList))
+	for _, key := range keyList {
+		retMap[key] = m.get(key)
+	}
+	return retMap
+}
+
+func (m *MemoryCache) SetCache(ctx context.Context, key string, val string) SetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.set(key, val)
+	return SetCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+}
+
+func (m *MemoryCache) BatchSetCache(ctx context.Context, keyList []string, valList []string) map[string]SetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	retMap := make(map[string]SetCacheResult, len(keyList))
+	for idx, key := range keyList {
+		m.set(key, valList[idx])
+		retMap[key] = SetCacheResult{
+			HandleErrStrategy: m.opts.strategy,
+		}
+	}
+	return retMap
+}
+
+func (m *MemoryCache) ClearCache(ctx context.Context, key string) ClearCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clear(key)
+	return ClearCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+}
+
+func (m *MemoryCache) BatchClearCache(ctx context.Context, keyList []string) map[string]ClearCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	retMap := make(map[string]ClearCacheResult, len(keyList))
+	for _, key := range keyList {
+		m.clear(key)
+		retMap[key] = ClearCacheResult{
+			HandleErrStrategy: m.opts.strategy,
+		}
+	}
+	return retMap
+}
+
+func (m *MemoryCache) RetryGetFromCache(ctx context.Context, key string) GetCacheResult {
+	return m.GetFromCache(ctx, key)
+}
+
+func (m *MemoryCache) RetrySetCache(ctx context.Context, key string, val string) SetCacheResult {
+	return m.SetCache(ctx, key, val)
+}
+
+func (m *MemoryCache) RetryClearCache(ctx context.Context, key string) ClearCacheResult {
+	return m.ClearCache(ctx, key)
+}
+
+func (m *MemoryCache) GetWithVersion(ctx context.Context, key string) GetVersionCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := GetVersionCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+	entry := m.load(key)
+	if entry == nil {
+		ret.Err = cacheerr.CacheMiss
+		return ret
+	}
+	//已清除的也算未命中, 但带上版本号, 作为最后一层缓存时可以直接用
+	ret.Version = entry.version
+	if !entry.exist {
+		ret.Err = cacheerr.CacheMiss
+		return ret
+	}
+	ret.Exist = entry.value != ""
+	ret.Value = entry.value
+	return ret
+}
+
+func (m *MemoryCache) CompareAndSet(ctx context.Context, key string, expectedVersion int64, val string) CasCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := CasCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+	var current int64
+	if entry := m.load(key); entry != nil {
+		current = entry.version
+	}
+	if current != expectedVersion {
+		ret.Version = current
+		return ret
+	}
+	ret.Swapped = true
+	ret.Version = m.set(key, val)
+	return ret
+}
+
+func (m *MemoryCache) SetWithVersion(ctx context.Context, key string, val string, version int64) SetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if entry := m.load(key); entry == nil || !entry.exist || entry.version <= version {
+		m.data[m.prefixKey(key)] = &memoryEntry{
+			value:    val,
+			exist:    true,
+			version:  version,
+			expireAt: m.expireAt(),
+		}
+	}
+	return SetCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+}
+
+func (m *MemoryCache) AddTag(ctx context.Context, key string, tagList []string) SetCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= memoryTagSweepInterval {
+		m.lastSweep = now
+		m.sweepTags(now)
+	}
+	tagged, ok := m.keyTags[key]
+	if !ok {
+		tagged = &memoryTaggedKey{tagKeySet: make(map[string]struct{})}
+		m.keyTags[key] = tagged
+	}
+	tagged.taggedAt = now
+	for _, tag := range tagList {
+		tagKey := m.tagKey(tag)
+		if _, ok := m.tags[tagKey]; !ok {
+			m.tags[tagKey] = make(map[string]struct{})
+		}
+		m.tags[tagKey][key] = struct{}{}
+		tagged.tagKeySet[tagKey] = struct{}{}
+	}
+	return SetCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+}
+
+// GetTagKeys 按 key 排序遍历, cursor 为上一批的最后一个 key, 遍历中删除 key 不影响后面的
+func (m *MemoryCache) GetTagKeys(ctx context.Context, tag string, cursor string, count int) TagKeysResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := TagKeysResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+	keyList := make([]string, 0, len(m.tags[m.tagKey(tag)]))
+	for key := range m.tags[m.tagKey(tag)] {
+		if cursor == "" || key > cursor {
+			keyList = append(keyList, key)
+		}
+	}
+	sort.Strings(keyList)
+	if count > 0 && len(keyList) > count {
+		keyList = keyList[:count]
+		ret.Cursor = keyList[count-1]
+	}
+	ret.KeyList = keyList
+	return ret
+}
+
+func (m *MemoryCache) RemoveTagKeys(ctx context.Context, tag string, keyList []string) ClearCacheResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	tagKey := m.tagKey(tag)
+	for _, key := range keyList {
+		m.removeTag(tagKey, key)
+	}
+	return ClearCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+}
+
+func (m *MemoryCache) Peek(ctx context.Context, key string) PeekCacheResult {
+	getRet := m.GetFromCache(ctx, key)
+	if errors.Is(getRet.Err, cacheerr.CacheMiss) {
+		return PeekCacheResult{}
+	}
+	return PeekCacheResult{
+		Value:     getRet.Value,
+		Exist:     getRet.Exist,
+		ErrHelper: getRet.ErrHelper,
+	}
+}
+
+// Len 当前缓存的 key 数, 包括已过期还未删除的
+func (m *MemoryCache) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.data)
+}
+
+func (m *MemoryCache) get(key string) GetCacheResult {
+	ret := GetCacheResult{
+		HandleErrStrategy: m.opts.strategy,
+	}
+	entry := m.load(key)
+	if entry == nil || !entry.exist {
+		ret.Err = cacheerr.CacheMiss
+		return ret
+	}
+	ret.Exist = entry.value != ""
+	ret.Value = entry.value
+	return ret
+}
+
+func (m *MemoryCache) set(key string, val string) int64 {
+	var version int64 = 1
+	if entry := m.load(key); entry != nil {
+		version = entry.version + 1
+	}
+	m.data[m.prefixKey(key)] = &memoryEntry{
+		value:    val,
+		exist:    true,
+		version:  version,
+		expireAt: m.expireAt(),
+	}
+	return version
+}
+
+func (m *MemoryCache) clear(key string) {
+	entry := m.load(key)
+	if entry == nil {
+		return
+	}
+	//保留版本号并递增, 避免清除后旧版本号的 CompareAndSet 写入成功
+	entry.value = ""
+	entry.exist = false
+	entry.version++
+	m.dropTags(key)
+}
+
+func (m *MemoryCache) load(key string) *memoryEntry {
+	prefixKey := m.prefixKey(key)
+	entry, ok := m.data[prefixKey]
+	if !ok {
+		return nil
+	}
+	if entry.isExpired(time.Now()) {
+		delete(m.data, prefixKey)
+		m.dropTags(key)
+		return nil
+	}
+	return entry
+}
+
+// sweepTags 删掉值已过期/清除的 key 的标签, 以及加了标签后超过 memoryTagGrace 还没写入值的
+func (m *MemoryCache) sweepTags(now time.Time) {
+	for key, tagged := range m.keyTags {
+		entry := m.load(key)
+		if entry != nil && entry.exist {
+			continue
+		}
+		if entry == nil && now.Sub(tagged.taggedAt) < memoryTagGrace {
+			continue
+		}
+		m.dropTags(key)
+	}
+}
+
+// dropTags 从 key 的所有标签中删掉这个 key
+func (m *MemoryCache) dropTags(key string) {
+	tagged, ok := m.keyTags[key]
+	if !ok {
+		return
+	}
+	for tagKey := range tagged.tagKeySet {
+		m.removeTag(tagKey, key)
+	}
+}
+
+func (m *MemoryCache) removeTag(tagKey string, key string) {
+	if keySet, ok := m.tags[tagKey]; ok {
+		delete(keySet, key)
+		if len(keySet) == 0 {
+			delete(m.tags, tagKey)
+		}
+	}
+	if tagged, ok := m.keyTags[key]; ok {
+		delete(tagged.tagKeySet, tagKey)
+		if len(tagged.tagKeySet) == 0 {
+			delete(m.keyTags, key)
+		}
+	}
+}
+
+func (m *MemoryCache) expireAt() time.Time {
+	if m.opts.expireTime <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(m.opts.expireTime) * time.Second)
+}
+
+func (m *MemoryCache) prefixKey(key string) string {
+	if m.keyPrefix == "" {
+		return key
+	}
+	return fmt.Sprintf(m.keyPrefix, key)
+}
+
+func (m *MemoryCache) tagKey(tag string) string {
+	return fmt.Sprintf("%s@%s", m.keyPrefix, tag)
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_TagPruned(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryCache()
+	memory.AddTag(ctx, "a", []string{"t"})
+	memory.SetCache(ctx, "a", "1")
+	memory.AddTag(ctx, "b", []string{"t"})
+	memory.SetCache(ctx, "b", "2")
+
+	//清除后标签随之删除
+	memory.ClearCache(ctx, "a")
+	if ret := memory.GetTagKeys(ctx, "t", "", 10); len(ret.KeyList) != 1 || ret.KeyList[0] != "b" {
+		t.Errorf("Expected only b tagged, got %v", ret.KeyList)
+	}
+
+	//过期后读取时删除
+	memory.lock.Lock()
+	memory.data["b"].expireAt = time.Now().Add(-time.Second)
+	memory.lock.Unlock()
+	memory.GetFromCache(ctx, "b")
+	if ret := memory.GetTagKeys(ctx, "t", "", 10); len(ret.KeyList) != 0 {
+		t.Errorf("Expected expired key untagged, got %v", ret.KeyList)
+	}
+
+	//没有读取的过期 key 和一直没写入值的 key 在下一次 AddTag 时清理
+	memory.AddTag(ctx, "c", []string{"t"})
+	memory.SetCache(ctx, "c", "3")
+	memory.AddTag(ctx, "d", []string{"t"})
+	memory.lock.Lock()
+	memory.data["c"].expireAt = time.Now().Add(-time.Second)
+	memory.keyTags["d"].taggedAt = time.Now().Add(-memoryTagGrace)
+	memory.lastSweep = time.Time{}
+	memory.lock.Unlock()
+	memory.AddTag(ctx, "e", []string{"t"})
+	if ret := memory.GetTagKeys(ctx, "t", "", 10); len(ret.KeyList) != 1 || ret.KeyList[0] != "e" {
+		t.Errorf("Expected only e tagged, got %v", ret.KeyList)
+	}
+	if len(memory.keyTags) != 1 {
+		t.Errorf("Expected reverse index pruned, got %d", len(memory.keyTags))
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -40,6 +41,8 @@ type options struct {
 	expireTime     int
 	maxWaitingLoop int
 	tokenPrefix    string
+	versionSuffix  string
+	tagPrefix      string
 	strategy       HandleErrStrategy
 	conn           component.RedisInterface
 }
@@ -62,6 +65,18 @@ func WithTokenPrefix(tokenPrefix string) RedisCacheOption {
 	}
 }
 
+func WithVersionSuffix(versionSuffix string) RedisCacheOption {
+	return func(o *options) {
+		o.versionSuffix = versionSuffix
+	}
+}
+
+func WithTagPrefix(tagPrefix string) RedisCacheOption {
+	return func(o *options) {
+		o.tagPrefix = tagPrefix
+	}
+}
+
 func WithHandleErrStrategy(strategy HandleErrStrategy) RedisCacheOption {
 	return func(o *options) {
 		o.strategy = strategy
@@ -80,6 +95,8 @@ type RedisCache struct {
 	batchFn   func(c context.Context, keyList []string) (map[string]string, error)
 	keyPrefix string
 	conn      component.RedisInterface
+	//fillTokens 当前进程拿着 token 正在回源的 key
+	fillTokens sync.Map
 }
 
 func NewRedisCache(opts ...RedisCacheOption) *RedisCache {
@@ -88,6 +105,8 @@ func NewRedisCache(opts ...RedisCacheOption) *RedisCache {
 		expireTime:     7 * 86400,
 		maxWaitingLoop: 5,
 		tokenPrefix:    "graymonster-cachechain-redis-token",
+		versionSuffix:  ":version",
+		tagPrefix:      "graymonster-cachechain-redis-tag",
 		strategy:       HandleErrStrategyContinue,
 	}
 	// 调用动态传入的参数进行设置值
@@ -135,7 +154,7 @@ func (r *RedisCache) BatchGetFromCache(c context.Context, keyList []string) map[
 
 func (r *RedisCache) SetCache(ctx context.Context, key string, val string) SetCacheResult {
 	prefixKey := fmt.Sprintf(r.keyPrefix, key)
-	_, err := r.conn.Del(ctx, prefixKey).Result()
+	err := r.redisDel(ctx, prefixKey)
 	if err != nil {
 		component.Logger.Errorf(ctx, "redis set key failed", zap.Error(err), zap.String("key", prefixKey))
 	}
@@ -171,7 +190,7 @@ func (r *RedisCache) BatchSetCache(ctx context.Context, keyList []string, valLis
 
 func (r *RedisCache) ClearCache(ctx context.Context, key string) ClearCacheResult {
 	prefixKey := fmt.Sprintf(r.keyPrefix, key)
-	_, err := r.conn.Del(ctx, prefixKey).Result()
+	err := r.redisDel(ctx, prefixKey)
 	if err != nil {
 		component.Logger.Errorf(ctx, "redis clear key failed", zap.Error(err), zap.String("key", prefixKey))
 	}
@@ -226,6 +245,205 @@ func (r *RedisCache) RetryClearCache(ctx context.Context, key string) ClearCache
 	}
 }
 
+func (r *RedisCache) GetWithVersion(ctx context.Context, key string) GetVersionCacheResult {
+	prefixKey := fmt.Sprintf(r.keyPrefix, key)
+	ret := GetVersionCacheResult{
+		HandleErrStrategy: r.opts.strategy,
+	}
+	script := `local current = redis.call('get', KEYS[1]) or ''
+               local version = redis.call('get', KEYS[2]) or '0'
+               return {current, version}`
+
+	val, err := r.conn.Eval(ctx, script, []string{prefixKey, r.versionKey(prefixKey)})
+	if err != nil {
+		component.Logger.Errorf(ctx, "redis get with version failed", zap.Error(err), zap.String("key", prefixKey))
+		ret.Err = err
+		return ret
+	}
+	current, version, err := parseRedisVersionReply(val)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	ret.Version = version
+	//正在回源的 token 当作不存在
+	if !strings.HasPrefix(current, fmt.Sprintf("%s@", r.opts.tokenPrefix)) {
+		ret.Exist = current != ""
+		ret.Value = current
+	}
+	return ret
+}
+
+func (r *RedisCache) CompareAndSet(ctx context.Context, key string, expectedVersion int64, val string) CasCacheResult {
+	prefixKey := fmt.Sprintf(r.keyPrefix, key)
+	ret := CasCacheResult{
+		HandleErrStrategy: r.opts.strategy,
+	}
+	//值和版本号一起写, 版本号不匹配时返回当前版本号
+	//直接覆盖正在回源的 token, 回源方拿 token 回写时会失败, 不会写入旧值
+	script := `local version = tonumber(redis.call('get', KEYS[2]) or '0')
+               if version ~= tonumber(ARGV[1]) then
+                   return {0, tostring(version)}
+               end
+               version = version + 1
+               redis.call('setex', KEYS[1], ARGV[3], ARGV[2])
+               redis.call('setex', KEYS[2], ARGV[3], tostring(version))
+               return {1, tostring(version)}`
+
+	reply, err := r.conn.Eval(ctx, script, []string{prefixKey, r.versionKey(prefixKey)}, expectedVersion, val, r.opts.expireTime)
+	if err != nil {
+		component.Logger.Errorf(ctx, "redis compare and set failed", zap.Error(err), zap.String("key", prefixKey))
+		ret.Err = err
+		return ret
+	}
+	swapped, version, err := parseRedisCasReply(reply)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	ret.Swapped = swapped
+	ret.Version = version
+	return ret
+}
+
+func (r *RedisCache) SetWithVersion(ctx context.Context, key string, val string, version int64) SetCacheResult {
+	prefixKey := fmt.Sprintf(r.keyPrefix, key)
+	script := `local current = redis.call('get', KEYS[1])
+               local version = tonumber(redis.call('get', KEYS[2]) or '0')
+               if (not current) or version <= tonumber(ARGV[1]) then
+                   redis.call('setex', KEYS[1], ARGV[3], ARGV[2])
+                   redis.call('setex', KEYS[2], ARGV[3], ARGV[1])
+               end
+               return version`
+
+	_, err := r.conn.Eval(ctx, script, []string{prefixKey, r.versionKey(prefixKey)}, version, val, r.opts.expireTime)
+	if err != nil {
+		component.Logger.Errorf(ctx, "redis set with version failed", zap.Error(err), zap.String("key", prefixKey))
+	}
+	return SetCacheResult{
+		ErrHelper: helper.ErrHelper{
+			Err: err,
+		},
+		HandleErrStrategy: r.opts.strategy,
+	}
+}
+
+func (r *RedisCache) AddTag(ctx context.Context, key string, tagList []string) SetCacheResult {
+	ret := SetCacheResult{
+		HandleErrStrategy: r.opts.strategy,
+	}
+	if len(tagList) == 0 {
+		return ret
+	}
+	//标签索引的过期时间是缓存值的两倍, 每次打标签时续期, 避免紧接着写入的值比索引晚过期
+	//每个标签单独一条脚本, 不同标签可以在 redis cluster 的不同 slot
+	script := `redis.call('sadd', KEYS[1], ARGV[1])
+               return redis.call('expire', KEYS[1], ARGV[2])`
+	pipe := r.conn.Pipeline()
+	for _, tag := range tagList {
+		pipe.Eval(ctx, script, []string{r.tagKey(tag)}, key, 2*r.opts.expireTime)
+	}
+	cmdList, err := pipe.Exec(ctx)
+	if err == nil {
+		for _, cmd := range cmdList {
+			if _, err = cmd.Result(); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		component.Logger.Errorf(ctx, "redis add tag failed", zap.Error(err), zap.String("key", key), zap.Any("tag", tagList))
+		ret.Err = err
+	}
+	return ret
+}
+
+// GetTagKeys 使用 sscan 遍历, 遍历中删除 key 不影响后面的
+func (r *RedisCache) GetTagKeys(ctx context.Context, tag string, cursor string, count int) TagKeysResult {
+	ret := TagKeysResult{
+		HandleErrStrategy: r.opts.strategy,
+	}
+	if cursor == "" {
+		cursor = "0"
+	}
+	script := `return redis.call('sscan', KEYS[1], ARGV[1], 'count', ARGV[2])`
+	val, err := r.conn.Eval(ctx, script, []string{r.tagKey(tag)}, cursor, count)
+	if err != nil {
+		component.Logger.Errorf(ctx, "redis get tag keys failed", zap.Error(err), zap.String("tag", tag))
+		ret.Err = err
+		return ret
+	}
+	reply, ok := val.([]interface{})
+	if !ok || len(reply) != 2 {
+		ret.Err = errors.New(fmt.Sprintf("redis tag keys reply invalid %v", val))
+		return ret
+	}
+	next, _ := reply[0].(string)
+	arr, ok := reply[1].([]interface{})
+	if !ok {
+		ret.Err = errors.New(fmt.Sprintf("redis tag keys reply invalid %v", val))
+		return ret
+	}
+	if next != "0" {
+		ret.Cursor = next
+	}
+	ret.KeyList = make([]string, 0, len(arr))
+	for _, item := range arr {
+		if key, ok := item.(string); ok {
+			ret.KeyList = append(ret.KeyList, key)
+		}
+	}
+	return ret
+}
+
+func (r *RedisCache) RemoveTagKeys(ctx context.Context, tag string, keyList []string) ClearCacheResult {
+	ret := ClearCacheResult{
+		HandleErrStrategy: r.opts.strategy,
+	}
+	if len(keyList) == 0 {
+		return ret
+	}
+	args := make([]interface{}, len(keyList))
+	for idx, key := range keyList {
+		args[idx] = key
+	}
+	script := `return redis.call('srem', KEYS[1], unpack(ARGV))`
+	if _, err := r.conn.Eval(ctx, script, []string{r.tagKey(tag)}, args...); err != nil {
+		component.Logger.Errorf(ctx, "redis remove tag keys failed", zap.Error(err), zap.String("tag", tag))
+		ret.Err = err
+	}
+	return ret
+}
+
+func (r *RedisCache) Peek(ctx context.Context, key string) PeekCacheResult {
+	prefixKey := fmt.Sprintf(r.keyPrefix, key)
+	ret := PeekCacheResult{}
+	v, err := r.conn.Get(ctx, prefixKey)
+	if err == redis.Nil {
+		return ret
+	}
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	if strings.HasPrefix(v, fmt.Sprintf("%s@", r.opts.tokenPrefix)) {
+		ret.Filling = true
+		return ret
+	}
+	ret.Exist = v != ""
+	ret.Value = v
+	return ret
+}
+
+func (r *RedisCache) GetFillTokenList() []FillToken {
+	tokenList := make([]FillToken, 0)
+	r.fillTokens.Range(func(key, value interface{}) bool {
+		tokenList = append(tokenList, value.(FillToken))
+		return true
+	})
+	return tokenList
+}
+
 func (r *RedisCache) getFromRedis(c context.Context, key string) redisGetResult {
 	prefixKey := fmt.Sprintf(r.keyPrefix, key)
 	cacheVal := redisGetResult{
@@ -440,15 +658,7 @@ func (r *RedisCache) handleGetFromRedis(c context.Context, isBatch bool, handleM
 
 	//未拿到缓存且拿到读DB权限 去回写
 	if len(fromNoCacheList) > 0 {
-		var fromNoCacheVal = make(map[string]string)
-		var err error
-		if isBatch {
-			fromNoCacheVal, err = r.batchFn(c, fromNoCacheList)
-		} else {
-			v, errInner := r.fn(c, fromNoCacheList[0])
-			err = errInner
-			fromNoCacheVal[fromNoCacheList[0]] = v
-		}
+		fromNoCacheVal, err := r.loadNoCache(c, isBatch, fromNoCacheList, handleMap)
 		for _, key := range fromNoCacheList {
 			ret := GetCacheResult{}
 			ret.HandleErrStrategy = r.opts.strategy
@@ -471,6 +681,7 @@ func (r *RedisCache) handleGetFromRedis(c context.Context, isBatch bool, handleM
 			}
 			ret.Exist = fromNoCacheVal[key] != ""
 			ret.Value = fromNoCacheVal[key]
+			ret.Filled = true
 			retMap[key] = ret
 
 		}
@@ -496,6 +707,26 @@ func (r *RedisCache) handleGetFromRedis(c context.Context, isBatch bool, handleM
 	return retMap
 }
 
+// loadNoCache 回源期间记录拿着的 token, 回源函数 panic 时也会清掉
+func (r *RedisCache) loadNoCache(c context.Context, isBatch bool, keyList []string, handleMap map[string]redisGetResult) (map[string]string, error) {
+	for _, key := range keyList {
+		if token := handleMap[key].Token; token != "" {
+			r.fillTokens.Store(key, FillToken{Key: key, Token: token, StartAt: time.Now()})
+		}
+	}
+	defer func() {
+		for _, key := range keyList {
+			r.fillTokens.Delete(key)
+		}
+	}()
+
+	if isBatch {
+		return r.batchFn(c, keyList)
+	}
+	v, err := r.fn(c, keyList[0])
+	return map[string]string{keyList[0]: v}, err
+}
+
 func (r *RedisCache) setCacheWithToken(c context.Context, key, token, value string) error {
 	key = fmt.Sprintf(r.keyPrefix, key)
 	_, err := r.redisCas(c, key, token, value)
@@ -648,13 +879,90 @@ func (r *RedisCache) redisPipeGet(c context.Context, keyList []string) (map[stri
 	return valList, nil
 }
 
+// versionKey 版本号 key 和值 key 放在同一个 slot, redis cluster 下脚本才能同时操作两个 key
+func (r *RedisCache) versionKey(prefixKey string) string {
+	return redisHashTag(prefixKey) + r.opts.versionSuffix
+}
+
+// redisHashTag key 已有 hash tag 时原样返回, 否则整个 key 作为 hash tag, 和原 key 在同一个 slot
+func redisHashTag(key string) string {
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key
+		}
+	}
+	if strings.Contains(key, "}") {
+		//无法加 hash tag, 非 cluster 下不受影响
+		return key
+	}
+	return "{" + key + "}"
+}
+
+func (r *RedisCache) tagKey(tag string) string {
+	return fmt.Sprintf("%s@%s@%s", r.opts.tagPrefix, r.keyPrefix, tag)
+}
+
+// redisDelScript 删值的同时递增已有的版本号, 避免删除后旧版本号的 CompareAndSet 写入成功
+const redisDelScript = `local ret = redis.call('del', KEYS[1])
+               if redis.call('exists', KEYS[2]) == 1 then
+                   redis.call('incr', KEYS[2])
+               end
+               return ret`
+
+func (r *RedisCache) redisDel(c context.Context, prefixKey string) error {
+	_, err := r.conn.Eval(c, redisDelScript, []string{prefixKey, r.versionKey(prefixKey)})
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func parseRedisVersionReply(reply interface{}) (string, int64, error) {
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) != 2 {
+		return "", 0, errors.New(fmt.Sprintf("redis version reply invalid %v", reply))
+	}
+	current, ok := arr[0].(string)
+	if !ok {
+		return "", 0, errors.New(fmt.Sprintf("redis version reply invalid %v", reply))
+	}
+	versionString, ok := arr[1].(string)
+	if !ok {
+		return "", 0, errors.New(fmt.Sprintf("redis version reply invalid %v", reply))
+	}
+	version, err := strconv.ParseInt(versionString, 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return current, version, nil
+}
+
+func parseRedisCasReply(reply interface{}) (bool, int64, error) {
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) != 2 {
+		return false, 0, errors.New(fmt.Sprintf("redis cas reply invalid %v", reply))
+	}
+	swapped, ok := arr[0].(int64)
+	if !ok {
+		return false, 0, errors.New(fmt.Sprintf("redis cas reply invalid %v", reply))
+	}
+	versionString, ok := arr[1].(string)
+	if !ok {
+		return false, 0, errors.New(fmt.Sprintf("redis cas reply invalid %v", reply))
+	}
+	version, err := strconv.ParseInt(versionString, 10, 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return swapped == 1, version, nil
+}
+
 func (r *RedisCache) redisPipeDel(c context.Context, keyList []string) error {
 	keyListCount := len(keyList)
 	pipeCount := 0
 	pipe := r.conn.Pipeline()
 	for _, key := range keyList {
-		script := `return redis.call('del',KEYS[1]);`
-		pipe.Eval(c, script, []string{key})
+		pipe.Eval(c, redisDelScript, []string{key, r.versionKey(key)})
 		pipeCount++
 		if pipeCount%1000 == 0 || pipeCount == keyListCount {
 			cmdList, err := pipe.Exec(c)
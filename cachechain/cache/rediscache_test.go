@@ -0,0 +1,17 @@
+package cache
+
+import "testing"
+
+func TestRedisHashTag(t *testing.T) {
+	for key, expected := range map[string]string{
+		"user:1":      "{user:1}",
+		"{user}:1":    "{user}:1",
+		"a{user}b{c}": "a{user}b{c}",
+		"a{}b":        "a{}b",
+		"a}b":         "a}b",
+	} {
+		if got := redisHashTag(key); got != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, key, got)
+		}
+	}
+}
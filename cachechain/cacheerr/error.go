@@ -3,3 +3,11 @@ package cacheerr
 import "errors"
 
 var NoCacheSet = errors.New("没有配置任何缓存类型")
+
+var CacheMiss = errors.New("缓存未命中")
+
+var VersionNotSupport = errors.New("没有配置支持版本号的缓存类型")
+
+var TagNotSupport = errors.New("没有配置支持标签的缓存类型")
+
+var InspectNotSupport = errors.New("缓存类型不支持查看")
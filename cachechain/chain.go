@@ -7,10 +7,31 @@ import (
 	"github.com/graymonster0927/component/cachechain/cache"
 	"github.com/graymonster0927/component/cachechain/cacheerr"
 	"github.com/graymonster0927/component/cachechain/helper"
+	"sync/atomic"
 )
 
 type Chain struct {
-	cacheList []cache.CacheInterface
+	cacheList    []cache.CacheInterface
+	statsList    []*tierStats
+	tagBatchSize int
+}
+
+// tierStats 每层缓存的读取统计, 回源得到的值记为未命中
+type tierStats struct {
+	hit  atomic.Uint64
+	miss atomic.Uint64
+	err  atomic.Uint64
+}
+
+func (t *tierStats) record(getRet cache.GetCacheResult) {
+	switch {
+	case getRet.IsSuccess() && getRet.Exist && !getRet.Filled:
+		t.hit.Add(1)
+	case getRet.IsSuccess() || errors.Is(getRet.Err, cacheerr.CacheMiss):
+		t.miss.Add(1)
+	default:
+		t.err.Add(1)
+	}
 }
 
 type GetResult struct {
@@ -31,12 +52,15 @@ type ClearResult struct {
 
 func NewCacheChain() *Chain {
 	return &Chain{
-		cacheList: make([]cache.CacheInterface, 0),
+		cacheList:    make([]cache.CacheInterface, 0),
+		statsList:    make([]*tierStats, 0),
+		tagBatchSize: 500,
 	}
 }
 
 func (c *Chain) WithCache(cache cache.CacheInterface) {
 	c.cacheList = append(c.cacheList, cache)
+	c.statsList = append(c.statsList, &tierStats{})
 }
 
 func (c *Chain) SetFnGetNoCache(fn func(c context.Context, key string) (string, error)) {
@@ -66,8 +90,10 @@ func (c *Chain) Get(ctx context.Context, key string) GetResult {
 		return ret
 	}
 
-	for _, c := range c.cacheList {
+	statsList := c.statsList
+	for idx, c := range c.cacheList {
 		getRet := c.GetFromCache(ctx, key)
+		statsList[idx].record(getRet)
 		ret.CacheName = c.GetName()
 		if getRet.IsSuccess() {
 			ret.Err = nil
@@ -75,6 +101,8 @@ func (c *Chain) Get(ctx context.Context, key string) GetResult {
 			ret.Exist = getRet.Exist
 			ret.V = getRet.Value
 			return ret
+		} else if errors.Is(getRet.Err, cacheerr.CacheMiss) {
+			ret.Err = errors.Join(ret.Err, getRet.Err)
 		} else {
 			component.Logger.Errorf(ctx, "cache %s get failed, err: %v", c.GetName(), getRet.Err)
 			ret.Err = errors.Join(ret.Err, getRet.Err)
@@ -88,6 +116,7 @@ func (c *Chain) Get(ctx context.Context, key string) GetResult {
 			return ret
 		case cache.HandleErrStrategyRetry:
 			getRet = c.RetryGetFromCache(ctx, key)
+			statsList[idx].record(getRet)
 			if getRet.IsSuccess() {
 				ret.CacheName = c.GetName()
 				ret.FromCache = true
@@ -113,10 +142,12 @@ func (c *Chain) BatchGet(ctx context.Context, keyList []string) map[string]GetRe
 		return ret
 	}
 
-	for _, c := range c.cacheList {
+	statsList := c.statsList
+	for idx, c := range c.cacheList {
 		getRetMap := c.BatchGetFromCache(ctx, keyList)
 		keyList = make([]string, 0, len(keyList))
 		for key, getRet := range getRetMap {
+			statsList[idx].record(getRet)
 			if getRet.IsSuccess() {
 				ret[key] = GetResult{
 					CacheName: c.GetName(),
@@ -127,7 +158,9 @@ func (c *Chain) BatchGet(ctx context.Context, keyList []string) map[string]GetRe
 				}
 				continue
 			} else {
-				component.Logger.Errorf(ctx, "cache %s get failed, err: %v", c.GetName(), getRet.Err)
+				if !errors.Is(getRet.Err, cacheerr.CacheMiss) {
+					component.Logger.Errorf(ctx, "cache %s get failed, err: %v", c.GetName(), getRet.Err)
+				}
 				var preErr error
 				if _, ok := ret[key]; ok {
 					preErr = ret[key].Err
@@ -154,6 +187,7 @@ func (c *Chain) BatchGet(ctx context.Context, keyList []string) map[string]GetRe
 				}
 			case cache.HandleErrStrategyRetry:
 				getRet = c.RetryGetFromCache(ctx, key)
+				statsList[idx].record(getRet)
 				if getRet.IsSuccess() {
 					ret[key] = GetResult{
 						CacheName: c.GetName(),
@@ -0,0 +1,256 @@
+package cachechain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/graymonster0927/component/cachechain/cache"
+)
+
+func TestChain_CompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	chain := NewCacheChain()
+	chain.WithCache(cache.NewMemoryCache())
+
+	getRet := chain.GetWithVersion(ctx, "k")
+	if !getRet.IsSuccess() || getRet.Exist || getRet.Version != 0 {
+		t.Fatalf("Expected empty key with version 0, got %+v", getRet)
+	}
+
+	casRet := chain.CompareAndSet(ctx, "k", 0, "v1")
+	if !casRet.IsSuccess() || !casRet.Swapped || casRet.Version != 1 {
+		t.Fatalf("Expected swapped with version 1, got %+v", casRet)
+	}
+
+	casRet = chain.CompareAndSet(ctx, "k", 0, "v2")
+	if !casRet.IsSuccess() || casRet.Swapped || casRet.Version != 1 {
+		t.Fatalf("Expected not swapped with current version 1, got %+v", casRet)
+	}
+
+	chain.Clear(ctx, "k")
+	casRet = chain.CompareAndSet(ctx, "k", 1, "v2")
+	if casRet.Swapped {
+		t.Fatalf("Expected stale version rejected after clear, got %+v", casRet)
+	}
+
+	getRet = chain.GetWithVersion(ctx, "k")
+	if getRet.Exist || getRet.Version != casRet.Version {
+		t.Fatalf("Expected cleared key with version %d, got %+v", casRet.Version, getRet)
+	}
+}
+
+func TestChain_CompareAndSet_UpperTier(t *testing.T) {
+	ctx := context.Background()
+	lower := cache.NewMemoryCache()
+	upperA := cache.NewMemoryCache()
+	upperB := cache.NewMemoryCache()
+	//两个进程共用下层缓存
+	chainA := NewCacheChain()
+	chainA.WithCache(upperA)
+	chainA.WithCache(lower)
+	chainB := NewCacheChain()
+	chainB.WithCache(upperB)
+	chainB.WithCache(lower)
+
+	lower.CompareAndSet(ctx, "k", 0, "v1")
+	//上层缓存普通写入的值, 版本号和下层不一致
+	upperA.SetCache(ctx, "k", "stale")
+	upperA.SetCache(ctx, "k", "stale")
+
+	getRetA := chainA.GetWithVersion(ctx, "k")
+	if getRetA.V != "v1" || getRetA.Version != 1 {
+		t.Fatalf("Expected v1 with version 1 from lower tier, got %+v", getRetA)
+	}
+	getRetB := chainB.GetWithVersion(ctx, "k")
+	casRet := chainB.CompareAndSet(ctx, "k", getRetB.Version, "v2")
+	if !casRet.Swapped || casRet.Version != 2 {
+		t.Fatalf("Expected swapped with version 2, got %+v", casRet)
+	}
+	upperRet := upperB.GetWithVersion(ctx, "k")
+	if upperRet.Value != "v2" || upperRet.Version != casRet.Version {
+		t.Fatalf("Expected upper tier synced to v2, got %+v", upperRet)
+	}
+
+	//A 拿着旧版本号写入会失败, 不会覆盖 B 的写入
+	casRet = chainA.CompareAndSet(ctx, "k", getRetA.Version, "v3")
+	if casRet.Swapped || casRet.Version != 2 {
+		t.Fatalf("Expected version mismatch, got %+v", casRet)
+	}
+	if getRet := upperA.GetFromCache(ctx, "k"); getRet.Exist {
+		t.Fatalf("Expected stale upper tier cleared, got %+v", getRet)
+	}
+	if getRet := chainA.GetWithVersion(ctx, "k"); getRet.V != "v2" || getRet.Version != 2 {
+		t.Fatalf("Expected v2 with version 2, got %+v", getRet)
+	}
+}
+
+func TestChain_ClearByTag(t *testing.T) {
+	ctx := context.Background()
+	upper := cache.NewMemoryCache()
+	lower := cache.NewMemoryCache()
+	chain := NewCacheChain()
+	chain.WithCache(upper)
+	chain.WithCache(cache.NewCompressCache(lower))
+	chain.SetTagBatchSize(2)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if setRet := chain.SetWithTags(ctx, key, "v-"+key, []string{"tenant-x"}); !setRet.IsSuccess() {
+			t.Fatalf("Expected no error, got %v", setRet.Err)
+		}
+	}
+	chain.SetWithTags(ctx, "f", "v-f", []string{"tenant-y"})
+
+	clearRet := chain.ClearByTag(ctx, "tenant-x")
+	if !clearRet.IsSuccess() || clearRet.ClearCount != 5 {
+		t.Fatalf("Expected 5 keys cleared, got %+v", clearRet)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if getRet := chain.Get(ctx, key); getRet.Exist {
+			t.Errorf("Expected %s cleared, got %+v", key, getRet)
+		}
+	}
+	if getRet := chain.Get(ctx, "f"); getRet.V != "v-f" {
+		t.Errorf("Expected f kept, got %+v", getRet)
+	}
+	//再次打上标签后可以再次按标签清除
+	chain.SetWithTags(ctx, "a", "v-a", []string{"tenant-x"})
+	if clearRet := chain.ClearByTag(ctx, "tenant-x"); clearRet.ClearCount != 1 {
+		t.Errorf("Expected 1 key cleared, got %+v", clearRet)
+	}
+}
+
+type countingCache struct {
+	*cache.MemoryCache
+	lock      sync.Mutex
+	batchList [][]string
+}
+
+func (c *countingCache) BatchGetFromCache(ctx context.Context, keyList []string) map[string]cache.GetCacheResult {
+	c.lock.Lock()
+	c.batchList = append(c.batchList, keyList)
+	c.lock.Unlock()
+	return c.MemoryCache.BatchGetFromCache(ctx, keyList)
+}
+
+func TestBatchLoader_Coalesce(t *testing.T) {
+	ctx := context.Background()
+	counting := &countingCache{MemoryCache: cache.NewMemoryCache()}
+	chain := NewCacheChain()
+	chain.WithCache(counting)
+	chain.BatchSet(ctx, []string{"a", "b", "c"}, []string{"1", "2", "3"})
+
+	loader := NewBatchLoader(chain, WithLoaderWait(20*time.Millisecond), WithLoaderMaxBatch(100))
+	wg := sync.WaitGroup{}
+	for _, keyList := range [][]string{{"a", "b"}, {"b", "c"}, {"a", "c"}} {
+		wg.Add(1)
+		go func(keyList []string) {
+			defer wg.Done()
+			for key, getRet := range loader.BatchGet(ctx, keyList) {
+				if !getRet.Exist {
+					t.Errorf("Expected %s exist, got %+v", key, getRet)
+				}
+			}
+		}(keyList)
+	}
+	wg.Wait()
+
+	if len(counting.batchList) != 1 || len(counting.batchList[0]) != 3 {
+		t.Errorf("Expected one batch with 3 keys, got %v", counting.batchList)
+	}
+}
+
+func TestBatchLoader_MaxBatch(t *testing.T) {
+	ctx := context.Background()
+	counting := &countingCache{MemoryCache: cache.NewMemoryCache()}
+	chain := NewCacheChain()
+	chain.WithCache(counting)
+
+	loader := NewBatchLoader(chain, WithLoaderWait(time.Hour), WithLoaderMaxBatch(2))
+	ret := loader.BatchGet(ctx, []string{"a", "b", "c", "d"})
+	if len(ret) != 4 || len(counting.batchList) != 2 {
+		t.Errorf("Expected 4 results in 2 batches, got %v and %v", ret, counting.batchList)
+	}
+
+	loader = NewBatchLoader(chain, WithLoaderWait(50*time.Millisecond))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if getRet := loader.Get(timeoutCtx, "e"); !errors.Is(getRet.Err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %+v", getRet)
+	}
+}
+
+// wrappedCache 只暴露 CacheInterface 的包装层
+type wrappedCache struct {
+	cache.CacheInterface
+}
+
+func (w *wrappedCache) Unwrap() cache.CacheInterface {
+	return w.CacheInterface
+}
+
+func TestAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	chain := NewCacheChain()
+	chain.WithCache(&wrappedCache{cache.NewMemoryCache()})
+	chain.Set(ctx, "k", "v")
+	chain.Get(ctx, "k")
+	chain.Get(ctx, "missing")
+
+	handler := NewAdminHandler(chain, WithAdminAuth(func(r *http.Request) bool {
+		return r.Header.Get("X-Token") == "secret"
+	}))
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Token", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tiers", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected forbidden, got %d", rec.Code)
+	}
+
+	var tiers struct {
+		Data []AdminTier `json:"data"`
+	}
+	rec = do(http.MethodGet, "/tiers")
+	if err := json.Unmarshal(rec.Body.Bytes(), &tiers); err != nil || len(tiers.Data) != 1 {
+		t.Fatalf("Expected one tier, got %s", rec.Body.String())
+	}
+	if tier := tiers.Data[0]; tier.Hit != 1 || tier.Miss != 1 || tier.Size != 1 || !tier.Version || !tier.Tag || !tier.Peek {
+		t.Errorf("Unexpected tier %+v", tier)
+	}
+	//回源得到的值记为未命中
+	chain.statsList[0].record(cache.GetCacheResult{Value: "v", Exist: true, Filled: true})
+	if miss := chain.statsList[0].miss.Load(); miss != 2 {
+		t.Errorf("Expected fill counted as miss, got %d", miss)
+	}
+
+	var peek struct {
+		Data []AdminPeek `json:"data"`
+	}
+	rec = do(http.MethodGet, "/peek?key=k")
+	if err := json.Unmarshal(rec.Body.Bytes(), &peek); err != nil || len(peek.Data) != 1 || peek.Data[0].Value != "v" {
+		t.Fatalf("Expected peek value v, got %s", rec.Body.String())
+	}
+
+	if rec = do(http.MethodGet, "/clear?key=k"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected method not allowed, got %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, "/clear?key=k"); rec.Code != http.StatusOK {
+		t.Errorf("Expected ok, got %d %s", rec.Code, rec.Body.String())
+	}
+	if getRet := chain.Get(ctx, "k"); getRet.Exist {
+		t.Errorf("Expected k cleared, got %+v", getRet)
+	}
+}
@@ -0,0 +1,142 @@
+package cachechain
+
+import (
+	"context"
+	"github.com/graymonster0927/component/cachechain/helper"
+	"sync"
+	"time"
+)
+
+type BatchLoaderOption func(*batchLoaderOptions)
+
+type batchLoaderOptions struct {
+	wait     time.Duration
+	maxBatch int
+}
+
+// WithLoaderWait 收集 key 的时间窗口
+func WithLoaderWait(wait time.Duration) BatchLoaderOption {
+	return func(o *batchLoaderOptions) {
+		o.wait = wait
+	}
+}
+
+// WithLoaderMaxBatch 一批最多的 key 数, 达到后立即发起
+func WithLoaderMaxBatch(maxBatch int) BatchLoaderOption {
+	return func(o *batchLoaderOptions) {
+		o.maxBatch = maxBatch
+	}
+}
+
+type loaderBatch struct {
+	ctx        context.Context
+	keyList    []string
+	dispatched bool
+	timer      *time.Timer
+	done       chan struct{}
+	ret        map[string]GetResult
+}
+
+// BatchLoader 合并并发的 BatchGet
+// 时间窗口内或达到批大小前的 key 合并成一次 Chain.BatchGet, 每层缓存只批量读一次, 回源函数也只调用一次
+// 正在执行的批次中已有的 key 直接等待结果, 不会重复读取
+type BatchLoader struct {
+	chain    *Chain
+	opts     batchLoaderOptions
+	lock     sync.Mutex
+	batch    *loaderBatch
+	inflight map[string]*loaderBatch
+}
+
+func NewBatchLoader(chain *Chain, opts ...BatchLoaderOption) *BatchLoader {
+	op := batchLoaderOptions{
+		wait:     2 * time.Millisecond,
+		maxBatch: 500,
+	}
+	for _, option := range opts {
+		option(&op)
+	}
+	return &BatchLoader{
+		chain:    chain,
+		opts:     op,
+		inflight: make(map[string]*loaderBatch),
+	}
+}
+
+func (b *BatchLoader) Get(ctx context.Context, key string) GetResult {
+	return b.BatchGet(ctx, []string{key})[key]
+}
+
+func (b *BatchLoader) BatchGet(ctx context.Context, keyList []string) map[string]GetResult {
+	waitMap := make(map[string]*loaderBatch, len(keyList))
+
+	b.lock.Lock()
+	for _, key := range keyList {
+		if _, ok := waitMap[key]; ok {
+			continue
+		}
+		if batch, ok := b.inflight[key]; ok {
+			waitMap[key] = batch
+			continue
+		}
+		if b.batch == nil {
+			batch := &loaderBatch{
+				ctx:  ctx,
+				done: make(chan struct{}),
+			}
+			b.batch = batch
+			batch.timer = time.AfterFunc(b.opts.wait, func() {
+				b.dispatch(batch)
+			})
+		}
+		batch := b.batch
+		batch.keyList = append(batch.keyList, key)
+		b.inflight[key] = batch
+		waitMap[key] = batch
+		if len(batch.keyList) >= b.opts.maxBatch {
+			b.batch = nil
+			go b.dispatch(batch)
+		}
+	}
+	b.lock.Unlock()
+
+	ret := make(map[string]GetResult, len(waitMap))
+	for key, batch := range waitMap {
+		select {
+		case <-batch.done:
+			ret[key] = batch.ret[key]
+		case <-ctx.Done():
+			ret[key] = GetResult{
+				ErrHelper: helper.ErrHelper{Err: ctx.Err()},
+			}
+		}
+	}
+	return ret
+}
+
+func (b *BatchLoader) dispatch(batch *loaderBatch) {
+	b.lock.Lock()
+	if batch.dispatched {
+		b.lock.Unlock()
+		return
+	}
+	batch.dispatched = true
+	//达到批大小提前发起时停掉窗口定时器
+	batch.timer.Stop()
+	if b.batch == batch {
+		b.batch = nil
+	}
+	b.lock.Unlock()
+
+	//合并后的批次不受单个调用方取消的影响
+	batch.ret = b.chain.BatchGet(context.WithoutCancel(batch.ctx), batch.keyList)
+
+	b.lock.Lock()
+	for _, key := range batch.keyList {
+		if b.inflight[key] == batch {
+			delete(b.inflight, key)
+		}
+	}
+	b.lock.Unlock()
+	close(batch.done)
+}
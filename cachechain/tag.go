@@ -0,0 +1,114 @@
+package cachechain
+
+import (
+	"context"
+	"errors"
+	"github.com/graymonster0927/component"
+	"github.com/graymonster0927/component/cachechain/cache"
+	"github.com/graymonster0927/component/cachechain/cacheerr"
+	"github.com/graymonster0927/component/cachechain/helper"
+)
+
+type ClearByTagResult struct {
+	helper.ErrHelper
+	ClearCount int
+}
+
+// SetTagBatchSize 按标签清除时每批清除的 key 数
+func (c *Chain) SetTagBatchSize(tagBatchSize int) {
+	if tagBatchSize <= 0 {
+		return
+	}
+	c.tagBatchSize = tagBatchSize
+}
+
+// SetWithTags 先把 key 加入各缓存层的标签索引再写缓存, 保证有值的 key 一定能按标签清除
+// 标签只在 SetWithTags 时加上: 按标签清除或值过期后, 回源写入的值不带标签, 需要再次 SetWithTags 才能按标签清除
+func (c *Chain) SetWithTags(ctx context.Context, key string, val string, tagList []string) SetResult {
+	ret := SetResult{}
+
+	if len(c.cacheList) == 0 {
+		ret.Err = cacheerr.NoCacheSet
+		return ret
+	}
+
+	for _, c := range c.cacheList {
+		tagCache, ok := cache.AsTagCache(c)
+		if !ok {
+			continue
+		}
+		if tagRet := tagCache.AddTag(ctx, key, tagList); !tagRet.IsSuccess() {
+			component.Logger.Errorf(ctx, "cache %s add tag failed, err: %v", c.GetName(), tagRet.Err)
+			ret.Err = tagRet.Err
+			return ret
+		}
+	}
+
+	return c.Set(ctx, key, val)
+}
+
+// ClearByTag 清除所有缓存层中带有该标签的 key, 清除后 key 从标签中删除
+func (c *Chain) ClearByTag(ctx context.Context, tag string) ClearByTagResult {
+	ret := ClearByTagResult{}
+
+	if len(c.cacheList) == 0 {
+		ret.Err = cacheerr.NoCacheSet
+		return ret
+	}
+
+	tagCacheList := make([]cache.TagCacheInterface, 0, len(c.cacheList))
+	for _, item := range c.cacheList {
+		if tagCache, ok := cache.AsTagCache(item); ok {
+			tagCacheList = append(tagCacheList, tagCache)
+		}
+	}
+	if len(tagCacheList) == 0 {
+		ret.Err = cacheerr.TagNotSupport
+		return ret
+	}
+
+	//各层的索引可能不一样, 逐层按游标取出 key 清除, 清除后从所有层的索引中删掉
+	//游标可能返回重复的 key, 按去重后的 key 计数
+	clearedSet := make(map[string]struct{})
+	for _, tagCache := range tagCacheList {
+		cursor := ""
+		for {
+			keysRet := tagCache.GetTagKeys(ctx, tag, cursor, c.tagBatchSize)
+			if !keysRet.IsSuccess() {
+				ret.Err = errors.Join(ret.Err, keysRet.Err)
+				break
+			}
+			cursor = keysRet.Cursor
+			if len(keysRet.KeyList) == 0 {
+				if cursor == "" {
+					break
+				}
+				continue
+			}
+
+			clearedList := make([]string, 0, len(keysRet.KeyList))
+			for key, clearRet := range c.BatchClear(ctx, keysRet.KeyList) {
+				if clearRet.IsSuccess() {
+					clearedList = append(clearedList, key)
+					clearedSet[key] = struct{}{}
+				} else {
+					ret.Err = errors.Join(ret.Err, clearRet.Err)
+				}
+			}
+			for _, item := range tagCacheList {
+				if removeRet := item.RemoveTagKeys(ctx, tag, clearedList); !removeRet.IsSuccess() {
+					component.Logger.Errorf(ctx, "cache remove tag %s keys failed, err: %v", tag, removeRet.Err)
+					ret.Err = errors.Join(ret.Err, removeRet.Err)
+				}
+			}
+
+			//清除失败的 key 留在索引中, 游标继续往后取, 不会重复取到
+			if cursor == "" {
+				break
+			}
+		}
+	}
+	ret.ClearCount = len(clearedSet)
+
+	return ret
+}
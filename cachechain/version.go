@@ -0,0 +1,102 @@
+package cachechain
+
+import (
+	"context"
+	"errors"
+	"github.com/graymonster0927/component"
+	"github.com/graymonster0927/component/cachechain/cache"
+	"github.com/graymonster0927/component/cachechain/cacheerr"
+	"github.com/graymonster0927/component/cachechain/helper"
+)
+
+type GetWithVersionResult struct {
+	GetResult
+	Version int64
+}
+
+type CompareAndSetResult struct {
+	helper.ErrHelper
+	//Swapped 版本号匹配且写入成功
+	Swapped bool
+	//Version 写入成功时为新版本号, 失败时为当前版本号
+	Version   int64
+	CacheName string
+}
+
+// GetWithVersion 获取值和版本号, 不会回源
+// 版本号以链上最后一层支持版本号的缓存为准, 前面的缓存层可能是普通写入的值, 版本号不可信, 不参与读取
+func (c *Chain) GetWithVersion(ctx context.Context, key string) GetWithVersionResult {
+	ret := GetWithVersionResult{}
+
+	versionList := c.getVersionCacheList()
+	if len(versionList) == 0 {
+		ret.Err = cacheerr.VersionNotSupport
+		return ret
+	}
+
+	last := versionList[len(versionList)-1]
+	getRet := last.(cache.VersionCacheInterface).GetWithVersion(ctx, key)
+	ret.CacheName = last.GetName()
+	if errors.Is(getRet.Err, cacheerr.CacheMiss) {
+		//未命中 当作不存在
+		ret.Version = getRet.Version
+		return ret
+	}
+	if !getRet.IsSuccess() {
+		component.Logger.Errorf(ctx, "cache %s get with version failed, err: %v", last.GetName(), getRet.Err)
+		ret.Err = getRet.Err
+		return ret
+	}
+	ret.FromCache = true
+	ret.Exist = getRet.Exist
+	ret.V = getRet.Value
+	ret.Version = getRet.Version
+	return ret
+}
+
+// CompareAndSet 版本号等于 expectedVersion 时写入新值
+// 以最后一层支持版本号的缓存为准, 成功后同步前面的缓存层, 失败时清掉前面的缓存层, 避免普通读取拿到旧值
+func (c *Chain) CompareAndSet(ctx context.Context, key string, expectedVersion int64, val string) CompareAndSetResult {
+	ret := CompareAndSetResult{}
+
+	versionList := c.getVersionCacheList()
+	if len(versionList) == 0 {
+		ret.Err = cacheerr.VersionNotSupport
+		return ret
+	}
+
+	last := versionList[len(versionList)-1]
+	casRet := last.(cache.VersionCacheInterface).CompareAndSet(ctx, key, expectedVersion, val)
+	ret.CacheName = last.GetName()
+	if !casRet.IsSuccess() {
+		component.Logger.Errorf(ctx, "cache %s compare and set failed, err: %v", last.GetName(), casRet.Err)
+		ret.Err = casRet.Err
+		return ret
+	}
+	ret.Swapped = casRet.Swapped
+	ret.Version = casRet.Version
+
+	for _, c := range versionList[:len(versionList)-1] {
+		if casRet.Swapped {
+			if setRet := c.(cache.VersionCacheInterface).SetWithVersion(ctx, key, val, casRet.Version); !setRet.IsSuccess() {
+				component.Logger.Errorf(ctx, "cache %s set with version failed, err: %v", c.GetName(), setRet.Err)
+			}
+			continue
+		}
+		if clearRet := c.ClearCache(ctx, key); !clearRet.IsSuccess() {
+			component.Logger.Errorf(ctx, "cache %s clear failed, err: %v", c.GetName(), clearRet.Err)
+		}
+	}
+
+	return ret
+}
+
+func (c *Chain) getVersionCacheList() []cache.CacheInterface {
+	versionList := make([]cache.CacheInterface, 0, len(c.cacheList))
+	for _, c := range c.cacheList {
+		if _, ok := c.(cache.VersionCacheInterface); ok {
+			versionList = append(versionList, c)
+		}
+	}
+	return versionList
+}
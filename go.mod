@@ -1,6 +1,6 @@
 module github.com/graymonster0927/component
 
-go 1.20
+go 1.21
 
 require (
 	github.com/go-redis/redis/v8 v8.11.5
@@ -15,6 +15,11 @@ const (
 	taskTypeScanPort = 1
 )
 
+type scanParams struct {
+	ip   string
+	port int
+}
+
 type PortScan struct {
 	ctx         context.Context
 	ipList      []string
@@ -35,39 +40,29 @@ func (p *PortScan) SetTimeout(timeout time.Duration) {
 }
 
 func (p *PortScan) Scan() error {
-	taskPool := taskpool.GetTaskPool(p.ctx)
-	taskPool.SetGPoolSize(p.concurrent)
-	taskPool.SetTaskHandler(taskTypeScanPort, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-		ip := params["ip"].(string)
-		port := params["port"].(int)
-		return p.checkPortOpen(ip, port), nil
+	taskPool := taskpool.NewGroup[scanParams, bool](p.ctx)
+	taskPool.TaskPool().SetPoolSize(p.concurrent)
+	//协程池满了等待, 每个 ip 的端口一次提交
+	taskPool.TaskPool().SetBlockingSubmit(true)
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeScanPort, func(ctx context.Context, params scanParams) (bool, error) {
+		return p.checkPortOpen(params.ip, params.port), nil
 	})
 
-	count := 0
 	for _, ip := range p.ipList {
 		component.Logger.Infof(p.ctx, "scanning %s", ip)
 		for port := 1; port <= 65535; port++ {
-			taskPool.AddTask(taskTypeScanPort, fmt.Sprintf("%s:%d", ip, port), map[string]interface{}{
-				"ip":   ip,
-				"port": port,
+			taskPool.AddTask(taskTypeScanPort, fmt.Sprintf("%s:%d", ip, port), scanParams{
+				ip:   ip,
+				port: port,
 			})
-			count++
-			if (count)%p.concurrent == 0 {
-				if err := taskPool.Start(); err != nil {
-					return err
-				}
-				p.handleTaskResult(taskPool.GetRetList())
-				taskPool.Clear(p.ctx)
-				count = 0
-			}
-
 		}
-	}
-	if count > 0 {
-		if err := taskPool.Start(); err != nil {
+		err := taskPool.StartWithCallback(func(ret taskpool.GroupResult[bool]) {
+			p.handleTaskResult(ret.Label, ret.Ret)
+		})
+		if err != nil {
 			return err
 		}
-		p.handleTaskResult(taskPool.GetRetList())
 		taskPool.Clear(p.ctx)
 	}
 	return nil
@@ -85,18 +80,15 @@ func (p *PortScan) checkPortOpen(ip string, port int) bool {
 	return true
 }
 
-func (p *PortScan) handleTaskResult(retList map[string]interface{}) {
-	for key, v := range retList {
-		ret := v.(bool)
-		if ret {
-			arr := strings.Split(key, ":")
-			if len(arr) == 2 {
-				ip := arr[0]
-				portS := arr[1]
-				port, _ := strconv.Atoi(portS)
-				p.openPortMap[ip] = append(p.openPortMap[ip], port)
-			}
-		}
-
+func (p *PortScan) handleTaskResult(key string, open bool) {
+	if !open {
+		return
+	}
+	arr := strings.Split(key, ":")
+	if len(arr) == 2 {
+		ip := arr[0]
+		portS := arr[1]
+		port, _ := strconv.Atoi(portS)
+		p.openPortMap[ip] = append(p.openPortMap[ip], port)
 	}
 }
@@ -11,8 +11,8 @@ type RedisInterface interface {
 	Pipeline() Pipeliner
 	Del(ctx context.Context, keys ...string) Cmder
 	Get(ctx context.Context, key string) (string, error)
-	//LPush(ctx context.Context, key string, values ...interface{}) *IntCmd
-	//RPop(ctx context.Context, key string) *StringCmd
+	LPush(ctx context.Context, key string, values ...interface{}) *IntCmd
+	RPop(ctx context.Context, key string) *StringCmd
 }
 
 type Pipeliner interface {
@@ -44,6 +44,10 @@ func (cmd *StringCmd) Result() (string, error) {
 	return cmd.val, cmd.err
 }
 
+func (cmd *StringCmd) Args() []interface{} {
+	return cmd.args
+}
+
 type IntCmd struct {
 	baseCmd
 
@@ -54,6 +58,10 @@ func (cmd *IntCmd) Result() (int64, error) {
 	return cmd.val, cmd.err
 }
 
+func (cmd *IntCmd) Args() []interface{} {
+	return cmd.args
+}
+
 type RedisDefault struct{}
 
 func (r *RedisDefault) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
@@ -73,11 +81,11 @@ func (r *RedisDefault) Get(ctx context.Context, key string) (string, error) {
 }
 
 func (r *RedisDefault) LPush(ctx context.Context, key string, values ...interface{}) *IntCmd {
-	return nil
+	return &IntCmd{}
 }
 
 func (r *RedisDefault) RPop(ctx context.Context, key string) *StringCmd {
-	return nil
+	return &StringCmd{}
 }
 
 type RedisV8 struct {
@@ -153,6 +161,7 @@ func (r *RedisV8) LPush(ctx context.Context, key string, values ...interface{})
 	return &IntCmd{
 		baseCmd: baseCmd{
 			args: retCmd.Args(),
+			err:  retCmd.Err(),
 		},
 		val: retCmd.Val(),
 	}
@@ -160,9 +169,11 @@ func (r *RedisV8) LPush(ctx context.Context, key string, values ...interface{})
 
 func (r *RedisV8) RPop(ctx context.Context, key string) *StringCmd {
 	retCmd := r.Client.RPop(ctx, key)
+	//列表为空时 err 为 redis.Nil
 	return &StringCmd{
 		baseCmd: baseCmd{
 			args: retCmd.Args(),
+			err:  retCmd.Err(),
 		},
 		val: retCmd.Val(),
 	}
@@ -0,0 +1,92 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Classifier 判断错误是否需要重试, 返回 false 时立即返回这个错误
+type Classifier func(err error) bool
+
+// RetryOn 只重试 errors.Is 匹配其中之一的错误
+func RetryOn(errList ...error) Classifier {
+	return func(err error) bool {
+		for _, target := range errList {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PermanentError 不再重试的错误, 见 Permanent
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 包装后立即停止重试, 返回给调用方的是原始错误, 比如参数校验失败
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// RetryAfterError 指定下一次重试前的等待时间, 比如 HTTP 429 的 Retry-After
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("retry after %v: %v", e.Delay, e.Err)
+	}
+	return fmt.Sprintf("retry after %v", e.Delay)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter 下一次重试等待 delay, 代替退避算法计算的间隔, 仍然计入重试次数和总耗时
+// 可以用 fmt.Errorf("%w: %v", RetryAfter(delay), err) 带上原因
+func RetryAfter(delay time.Duration) error {
+	return &RetryAfterError{Delay: delay}
+}
+
+// classify 返回 false 时不再重试, 返回的错误去掉 Permanent 的包装
+// RetryAfter 的错误总是重试, 其他错误由 retryIf 判断, retryIf 为空时都重试
+func classify(err error, retryIf Classifier) (error, bool) {
+	var permanentErr *PermanentError
+	if errors.As(err, &permanentErr) {
+		return permanentErr.Err, false
+	}
+	var retryAfterErr *RetryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return err, true
+	}
+	if retryIf != nil && !retryIf(err) {
+		return err, false
+	}
+	return err, true
+}
+
+// nextDelay 错误指定了 RetryAfter 时代替退避间隔
+func nextDelay(err error, backoff time.Duration) time.Duration {
+	var retryAfterErr *RetryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return retryAfterErr.Delay
+	}
+	return backoff
+}
@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDoRetry_Permanent(t *testing.T) {
+	maxTimes := NewMaxTimes(3, time.Millisecond, 0, false)
+	validateErr := errors.New("invalid params")
+	attempts := 0
+	err := maxTimes.DoRetry(func() error {
+		attempts++
+		return Permanent(validateErr)
+	})
+	var retryErr *RetryError
+	if !errors.Is(err, validateErr) || !errors.As(err, &retryErr) || len(retryErr.Errors) != 1 || attempts != 1 {
+		t.Errorf("Expected stop on permanent error, got %v %d", err, attempts)
+	}
+}
+
+func TestDoRetry_RetryIf(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	retryHelper, err := GetRetryHelper(RetryMaxTimes, WithMaxTimesMaxTimes(3), WithMaxTimesRetryTimeout(time.Millisecond), WithMaxTimesRetryIf(RetryOn(errTimeout)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	attempts := 0
+	_ = retryHelper.DoRetry(func() error {
+		attempts++
+		return fmt.Errorf("call: %w", errTimeout)
+	})
+	if attempts != 3 {
+		t.Errorf("Expected timeout retried 3 times, got %d", attempts)
+	}
+
+	attempts = 0
+	_ = retryHelper.DoRetry(func() error {
+		attempts++
+		return errors.New("not found")
+	})
+	if attempts != 1 {
+		t.Errorf("Expected other error not retried, got %d", attempts)
+	}
+}
+
+func TestDoRetry_RetryAfter(t *testing.T) {
+	retryHelper, err := GetRetryHelper(RetryUntilSuccess, WithUntilSuccessRetryTimeout(time.Second), WithUntilSuccessRetryIf(RetryOn()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	attempts := 0
+	st := time.Now()
+	err = retryHelper.DoRetry(func() error {
+		attempts++
+		if attempts == 1 {
+			//RetryAfter 不受 RetryIf 限制 且代替退避间隔
+			return fmt.Errorf("%w: too many requests", RetryAfter(20*time.Millisecond))
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("Expected success on 2nd attempt, got %v %d", err, attempts)
+	}
+	if cost := time.Since(st); cost < 20*time.Millisecond || cost >= time.Second {
+		t.Errorf("Expected wait retry after delay, got %v", cost)
+	}
+}
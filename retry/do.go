@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// policy 重试策略, doRetry 和 KeyedRetry 共用
+type policy interface {
+	// next 已执行 retryTimes 次, 距第一次执行 elapsed, 返回下一次重试前的等待时间, false 表示不再重试
+	next(retryTimes int, elapsed time.Duration, lastErr error) (time.Duration, bool)
+	classifier() Classifier
+	hook() hook
+	// attemptTimeout 单次执行的超时, 0 表示不限制
+	attemptTimeout() time.Duration
+}
+
+// hook 重试事件回调, name 为空时不上报指标
+type hook struct {
+	name    string
+	onRetry func(attempt int, err error, nextDelay time.Duration)
+}
+
+// Result DoRetryResult 的结果
+type Result struct {
+	Ret interface{}
+	//Attempts 执行的次数, Elapsed 总耗时包括重试间隔
+	Attempts int
+	Elapsed  time.Duration
+	//Errors 每次失败的错误, 取消时最后一个为 ctx 的错误
+	Errors []error
+}
+
+// RetryError DoRetry 等方法失败时返回, 包含每次执行的错误, errors.Is/As 可以匹配其中任意一个
+type RetryError struct {
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	msgList := make([]string, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		msgList = append(msgList, fmt.Sprintf("#%d: %v", i+1, err))
+	}
+	return fmt.Sprintf("retry failed after %d errors: %s", len(e.Errors), strings.Join(msgList, "; "))
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
+
+// doRetry 第一次立即执行, 失败后按 p 计算重试间隔, 错误不需要重试或 p 返回 false 时返回 *RetryError
+// ctx 取消后不再等待和执行, attemptTimeout 大于 0 时每次执行的 ctx 带单次超时
+func doRetry(ctx context.Context, attemptTimeout time.Duration, p policy, fn func(ctx context.Context) (interface{}, error)) (*Result, error) {
+	res := &Result{}
+	h := p.hook()
+	start := time.Now()
+	done := func(event string, err error) (*Result, error) {
+		res.Elapsed = time.Since(start)
+		reportDone(h, event, res.Attempts, res.Elapsed)
+		if err != nil {
+			return res, &RetryError{Errors: res.Errors}
+		}
+		return res, nil
+	}
+	cancelled := func() (*Result, error) {
+		res.Errors = append(res.Errors, ctx.Err())
+		return done(retryEventCancelled, ctx.Err())
+	}
+
+	var err error
+	for retryTimes := 0; ; retryTimes++ {
+		if retryTimes > 0 {
+			delay, ok := p.next(retryTimes, time.Since(start), err)
+			if !ok {
+				return done(retryEventFailed, err)
+			}
+			reportRetry(h, retryTimes, err, delay)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return cancelled()
+			}
+		}
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+
+		res.Attempts++
+		if res.Ret, err = attempt(ctx, attemptTimeout, fn); err == nil {
+			return done(retryEventSucceeded, nil)
+		}
+		var retryable bool
+		err, retryable = classify(err, p.classifier())
+		res.Errors = append(res.Errors, err)
+		if !retryable {
+			return done(retryEventFailed, err)
+		}
+	}
+}
+
+func attempt(ctx context.Context, attemptTimeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, attemptTimeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+func reportRetry(h hook, attempt int, err error, nextDelay time.Duration) {
+	if h.onRetry != nil {
+		h.onRetry(attempt, err, nextDelay)
+	}
+	if h.name != "" && RetryCounter != nil {
+		RetryCounter.WithLabelValues(h.name, retryEventRetry).Inc()
+	}
+}
+
+func reportDone(h hook, event string, attempts int, elapsed time.Duration) {
+	if h.name == "" || RetryCounter == nil {
+		return
+	}
+	RetryCounter.WithLabelValues(h.name, event).Inc()
+	RetryAttemptHistory.WithLabelValues(h.name).Observe(float64(attempts))
+	RetryHistory.WithLabelValues(h.name).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,15 @@
+package retry
+
+import (
+	"context"
+)
+
+// Do 带类型的重试, 可以使用任意注册的重试策略, 结果不需要再做类型断言
+// 失败时返回最后一次执行的结果和错误
+func Do[T any](ctx context.Context, helper Interface, fn func(ctx context.Context) (T, error)) (T, error) {
+	ret, err := helper.DoRetryReturnCtx(ctx, func(ctx context.Context) (interface{}, error) {
+		return fn(ctx)
+	})
+	r, _ := ret.(T)
+	return r, err
+}
@@ -0,0 +1,42 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID   int
+	Name string
+}
+
+func TestDo(t *testing.T) {
+	for _, strategy := range []Strategy{RetryMaxTimes, RetryUntilSuccess} {
+		retryHelper, err := GetRetryHelper(strategy, WithMaxTimesRetryTimeout(time.Millisecond), WithUntilSuccessRetryTimeout(time.Millisecond))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		attempts := 0
+		user, err := Do(context.Background(), retryHelper, func(ctx context.Context) (*testUser, error) {
+			attempts++
+			if attempts < 2 {
+				return nil, errors.New("test error")
+			}
+			return &testUser{ID: 1, Name: "a"}, nil
+		})
+		if err != nil || user == nil || user.Name != "a" {
+			t.Errorf("Expected typed result for strategy %d, got %+v %v", strategy, user, err)
+		}
+	}
+
+	//失败时返回零值
+	retryHelper := NewMaxTimes(2, time.Millisecond, 0, false)
+	n, err := Do(context.Background(), retryHelper, func(ctx context.Context) (int, error) {
+		return 0, errors.New("test error")
+	})
+	if err == nil || n != 0 {
+		t.Errorf("Expected error and zero value, got %d %v", n, err)
+	}
+}
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -15,7 +16,13 @@ const (
 type Interface interface {
 	DoRetryWithParams(key string, params ...any) error
 	DoRetryReturn(fn func() (interface{}, error)) (interface{}, error)
+	// DoRetry 失败时返回包含每次错误的 *RetryError, 需要用 errors.Is/As 判断
 	DoRetry(fn func() error) error
+	// DoRetryCtx ctx 取消后立即返回, 每次执行的 ctx 带单次超时
+	DoRetryCtx(ctx context.Context, fn func(ctx context.Context) error) error
+	DoRetryReturnCtx(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error)
+	// DoRetryResult 同 DoRetryReturnCtx, 返回执行次数和耗时
+	DoRetryResult(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (*Result, error)
 }
 
 type OptionsInterface interface {
@@ -58,4 +65,18 @@ func init() {
 	}); err != nil {
 		panic(err)
 	}
+
+	if err := RegisterStrategy(RetryUntilSuccess, func(options ...OptionFn) (Interface, error) {
+		ins := NewUntilSuccess(100*time.Millisecond, 10*time.Second, time.Minute, true, true)
+
+		option := &UntilSuccessOption{IsExponential: true, IsJitter: true}
+		for _, fn := range options {
+			fn(option)
+		}
+		option.Apply(ins)
+
+		return ins, nil
+	}); err != nil {
+		panic(err)
+	}
 }
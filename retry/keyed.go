@@ -0,0 +1,208 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component"
+	uuid "github.com/satori/go.uuid"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// RetryTask DoRetryWithParams 失败后持久化的任务
+// Params 经过 Redis/文件存储后是 json 解码的值, 比如数字为 float64
+type RetryTask struct {
+	ID       string `json:"id"`
+	Key      string `json:"key"`
+	Params   []any  `json:"params"`
+	Attempts int    `json:"attempts"`
+	//FirstAt 第一次执行的时间, NextAt 下一次重试的时间, 毫秒
+	FirstAt int64  `json:"first_at"`
+	NextAt  int64  `json:"next_at"`
+	LastErr string `json:"last_err"`
+}
+
+type KeyedOption func(*keyedOptions)
+
+type keyedOptions struct {
+	pollInterval time.Duration
+	lease        time.Duration
+	batchSize    int
+	deadLetter   func(ctx context.Context, task *RetryTask, err error)
+}
+
+// WithKeyedPollInterval 没有到期任务时的轮询间隔, 默认 1s
+func WithKeyedPollInterval(pollInterval time.Duration) KeyedOption {
+	return func(o *keyedOptions) {
+		o.pollInterval = pollInterval
+	}
+}
+
+// WithKeyedLease 取出的任务在 lease 内不会被其他进程再次取出, 任务按顺序执行, 需要大于一批任务执行的总耗时, 默认 30s
+func WithKeyedLease(lease time.Duration) KeyedOption {
+	return func(o *keyedOptions) {
+		o.lease = lease
+	}
+}
+
+// WithKeyedBatchSize 每次取出的任务数, 默认 100
+func WithKeyedBatchSize(batchSize int) KeyedOption {
+	return func(o *keyedOptions) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithKeyedDeadLetter 超过重试次数/总耗时或错误不需要重试时回调, 之后任务被删除
+func WithKeyedDeadLetter(deadLetter func(ctx context.Context, task *RetryTask, err error)) KeyedOption {
+	return func(o *keyedOptions) {
+		o.deadLetter = deadLetter
+	}
+}
+
+// KeyedRetry 按 key 注册处理函数, DoRetryWithParams 失败的调用持久化后在后台按重试策略重试
+// Run 取出的任务按顺序逐个执行, 一批任务的总耗时需要小于 lease, 需要并发时可以启动多个 Run
+type KeyedRetry struct {
+	store      Store
+	opts       keyedOptions
+	policy     policy
+	lock       sync.RWMutex
+	handlerMap map[string]func(ctx context.Context, params ...any) error
+}
+
+// NewKeyedRetry strategy 为 GetRetryHelper 返回的 MaxTimes/UntilSuccess, 决定重试次数, 间隔和单次执行的超时
+// UntilSuccess 的 MaxElapsed 从第一次执行开始计算
+func NewKeyedRetry(store Store, strategy Interface, opts ...KeyedOption) (*KeyedRetry, error) {
+	p, ok := strategy.(policy)
+	if !ok {
+		return nil, errors.New("this kind strategy not support keyed retry")
+	}
+	op := keyedOptions{
+		pollInterval: time.Second,
+		lease:        30 * time.Second,
+		batchSize:    100,
+	}
+	for _, option := range opts {
+		option(&op)
+	}
+	return &KeyedRetry{
+		store:      store,
+		opts:       op,
+		policy:     p,
+		handlerMap: make(map[string]func(ctx context.Context, params ...any) error),
+	}, nil
+}
+
+// Register 注册处理函数, 每个执行重试的进程都需要注册
+func (k *KeyedRetry) Register(key string, fn func(ctx context.Context, params ...any) error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.handlerMap[key] = fn
+}
+
+func (k *KeyedRetry) getHandler(key string) (func(ctx context.Context, params ...any) error, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	fn, ok := k.handlerMap[key]
+	return fn, ok
+}
+
+// DoRetryWithParams 立即执行一次, 失败后持久化等待 Run 重试, 成功或已持久化时返回 nil
+// 错误不需要重试时回调死信并返回这个错误
+func (k *KeyedRetry) DoRetryWithParams(key string, params ...any) error {
+	ctx := context.Background()
+	fn, ok := k.getHandler(key)
+	if !ok {
+		return errors.New(fmt.Sprintf("retry key %s have not register", key))
+	}
+	now := time.Now().UnixMilli()
+	task := &RetryTask{
+		ID:      uuid.NewV4().String(),
+		Key:     key,
+		Params:  params,
+		FirstAt: now,
+		NextAt:  now,
+	}
+	return k.process(ctx, fn, task, false)
+}
+
+// Run 持续取出到期的任务重试, ctx 取消后返回
+func (k *KeyedRetry) Run(ctx context.Context) error {
+	for {
+		taskList, err := k.store.Claim(ctx, time.Now(), k.opts.lease, k.opts.batchSize)
+		if err != nil && ctx.Err() == nil {
+			component.Logger.Errorf(ctx, "keyed retry claim failed: %v", err)
+		}
+		for _, task := range taskList {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fn, ok := k.getHandler(task.Key)
+			if !ok {
+				//lease 到期后由注册了处理函数的进程重试
+				component.Logger.Errorf(ctx, "keyed retry key %s have not register", task.Key)
+				continue
+			}
+			_ = k.process(ctx, fn, task, true)
+		}
+		if len(taskList) > 0 {
+			continue
+		}
+		select {
+		case <-time.After(k.opts.pollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// process 执行一次, 按重试策略删除/保存任务, stored 表示任务已经在存储中
+func (k *KeyedRetry) process(ctx context.Context, fn func(ctx context.Context, params ...any) error, task *RetryTask, stored bool) error {
+	p := k.policy
+	_, err := attempt(ctx, p.attemptTimeout(), func(ctx context.Context) (interface{}, error) {
+		return nil, k.call(ctx, fn, task)
+	})
+	task.Attempts++
+	elapsed := time.Since(time.UnixMilli(task.FirstAt))
+	if err == nil {
+		reportDone(p.hook(), retryEventSucceeded, task.Attempts, elapsed)
+		if stored {
+			return k.store.Delete(ctx, task.ID)
+		}
+		return nil
+	}
+
+	task.LastErr = err.Error()
+	err, retryable := classify(err, p.classifier())
+	delay, ok := p.next(task.Attempts, elapsed, err)
+	if !retryable || !ok {
+		reportDone(p.hook(), retryEventFailed, task.Attempts, elapsed)
+		if k.opts.deadLetter != nil {
+			k.opts.deadLetter(ctx, task, err)
+		}
+		if stored {
+			if deleteErr := k.store.Delete(ctx, task.ID); deleteErr != nil {
+				component.Logger.Errorf(ctx, "keyed retry delete %s failed: %v", task.ID, deleteErr)
+			}
+		}
+		return err
+	}
+	reportRetry(p.hook(), task.Attempts, err, delay)
+	task.NextAt = time.Now().Add(delay).UnixMilli()
+	if saveErr := k.store.Save(ctx, task); saveErr != nil {
+		component.Logger.Errorf(ctx, "keyed retry save %s failed: %v", task.ID, saveErr)
+		return saveErr
+	}
+	return nil
+}
+
+func (k *KeyedRetry) call(ctx context.Context, fn func(ctx context.Context, params ...any) error, task *RetryTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			component.Logger.Errorf(ctx, "keyed retry %s panic: %v\n%s", task.Key, r, debug.Stack())
+			err = errors.New(fmt.Sprintf("retry key %s panic: %v", task.Key, r))
+		}
+	}()
+	return fn(ctx, task.Params...)
+}
@@ -0,0 +1,144 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedRetry(t *testing.T) {
+	store := NewMemoryStore()
+	lock := sync.Mutex{}
+	deadList := make([]*RetryTask, 0)
+	retryHelper, err := GetRetryHelper(RetryMaxTimes, WithMaxTimesMaxTimes(3), WithMaxTimesRetryTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	keyed, err := NewKeyedRetry(store, retryHelper, WithKeyedPollInterval(5*time.Millisecond), WithKeyedDeadLetter(func(ctx context.Context, task *RetryTask, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		deadList = append(deadList, task)
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	attemptMap := make(map[string]int)
+	keyed.Register("notify", func(ctx context.Context, params ...any) error {
+		lock.Lock()
+		defer lock.Unlock()
+		id := params[0].(string)
+		attemptMap[id]++
+		if id == "ok" && attemptMap[id] < 2 {
+			return errors.New("test error")
+		}
+		if id == "fail" {
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	if err := retryHelper.DoRetryWithParams("notify"); err == nil {
+		t.Errorf("Expected strategy not support retry with params")
+	}
+	if err := keyed.DoRetryWithParams("unknown"); err == nil {
+		t.Errorf("Expected error for unregistered key")
+	}
+	if err := keyed.DoRetryWithParams("notify", "ok"); err != nil {
+		t.Fatalf("Expected failed call persisted, got %v", err)
+	}
+	if err := keyed.DoRetryWithParams("notify", "fail"); err != nil {
+		t.Fatalf("Expected failed call persisted, got %v", err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Expected 2 tasks persisted, got %d", store.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- keyed.Run(ctx)
+	}()
+	for i := 0; i < 100 && store.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	lock.Lock()
+	defer lock.Unlock()
+	if attemptMap["ok"] != 2 || attemptMap["fail"] != 3 {
+		t.Errorf("Expected ok succeeded on 2nd and fail tried 3 times, got %v", attemptMap)
+	}
+	if len(deadList) != 1 || deadList[0].Params[0] != "fail" || deadList[0].Attempts != 3 {
+		t.Errorf("Expected fail in dead letter, got %+v", deadList)
+	}
+}
+
+func TestKeyedRetry_Permanent(t *testing.T) {
+	var dead *RetryTask
+	retryHelper, _ := GetRetryHelper(RetryUntilSuccess)
+	keyed, _ := NewKeyedRetry(NewMemoryStore(), retryHelper, WithKeyedDeadLetter(func(ctx context.Context, task *RetryTask, err error) {
+		dead = task
+	}))
+	validateErr := errors.New("invalid")
+	keyed.Register("validate", func(ctx context.Context, params ...any) error {
+		return Permanent(validateErr)
+	})
+	if err := keyed.DoRetryWithParams("validate"); err != validateErr {
+		t.Errorf("Expected permanent error returned, got %v", err)
+	}
+	if dead == nil || dead.Attempts != 1 {
+		t.Errorf("Expected dead letter after 1 attempt, got %+v", dead)
+	}
+}
+
+func TestKeyedRetry_AttemptTimeout(t *testing.T) {
+	retryHelper, _ := GetRetryHelper(RetryMaxTimes, WithMaxTimesMaxTimes(1), WithMaxTimesAttemptTimeout(10*time.Millisecond))
+	keyed, _ := NewKeyedRetry(NewMemoryStore(), retryHelper)
+	keyed.Register("slow", func(ctx context.Context, params ...any) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	st := time.Now()
+	if err := keyed.DoRetryWithParams("slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected attempt timeout, got %v", err)
+	}
+	if time.Since(st) > time.Second {
+		t.Errorf("Expected attempt cancelled, got %v", time.Since(st))
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "retry.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	now := time.Now()
+	_ = store.Save(ctx, &RetryTask{ID: "a", Key: "k", Params: []any{1}, NextAt: now.UnixMilli()})
+	_ = store.Save(ctx, &RetryTask{ID: "b", Key: "k", NextAt: now.Add(time.Hour).UnixMilli()})
+
+	//重新打开后从文件恢复
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	taskList, _ := store.Claim(ctx, now, time.Minute, 10)
+	if len(taskList) != 1 || taskList[0].ID != "a" || taskList[0].Params[0] != float64(1) {
+		t.Fatalf("Expected a due, got %+v", taskList)
+	}
+	//lease 内不会再次取出
+	if taskList, _ := store.Claim(ctx, now, time.Minute, 10); len(taskList) != 0 {
+		t.Errorf("Expected a leased, got %+v", taskList)
+	}
+	_ = store.Delete(ctx, "a")
+	store, _ = NewFileStore(path)
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 task left, got %d", store.Len())
+	}
+}
@@ -0,0 +1,57 @@
+package retry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const (
+	retryEventRetry     = "retry"
+	retryEventSucceeded = "succeeded"
+	retryEventFailed    = "failed"
+	retryEventCancelled = "cancelled"
+)
+
+var (
+	RetryCounter        *prometheus.CounterVec
+	RetryHistory        *prometheus.HistogramVec
+	RetryAttemptHistory *prometheus.HistogramVec
+)
+
+// GetMetricCollectors 按重试策略的名字上报, 通过 WithMaxTimesName/WithUntilSuccessName 设置名字
+func GetMetricCollectors(ns string) []prometheus.Collector {
+	subSystem := "retry"
+	RetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subSystem,
+			Name:      "event",
+			Help:      "retry count by event: retry/succeeded/failed/cancelled",
+		},
+		[]string{"name", "event"},
+	)
+
+	RetryHistory = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: subSystem,
+			Name:      "elapsed_seconds",
+			Help:      "the total cost including retry delay",
+		},
+		[]string{"name"},
+	)
+
+	RetryAttemptHistory = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: subSystem,
+			Name:      "attempts",
+			Help:      "the attempts until succeeded or failed",
+			Buckets:   prometheus.LinearBuckets(1, 1, 10),
+		},
+		[]string{"name"},
+	)
+
+	return []prometheus.Collector{
+		RetryCounter,
+		RetryHistory,
+		RetryAttemptHistory,
+	}
+}
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestDoRetryResult(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, collector := range GetMetricCollectors("test") {
+		registry.MustRegister(collector)
+	}
+
+	delayList := make([]time.Duration, 0)
+	retryHelper, err := GetRetryHelper(RetryMaxTimes,
+		WithMaxTimesMaxTimes(3),
+		WithMaxTimesRetryTimeout(time.Millisecond),
+		WithMaxTimesName("test"),
+		WithMaxTimesOnRetry(func(attempt int, err error, nextDelay time.Duration) {
+			if attempt != len(delayList)+1 || err == nil {
+				t.Errorf("Unexpected retry event %d %v", attempt, err)
+			}
+			delayList = append(delayList, nextDelay)
+		}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	errA, errB := errors.New("a"), errors.New("b")
+	attempts := 0
+	res, err := retryHelper.DoRetryResult(context.Background(), func(ctx context.Context) (interface{}, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errA
+		}
+		return nil, errB
+	})
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Errors) != 3 {
+		t.Fatalf("Expected RetryError with 3 errors, got %v", err)
+	}
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Expected all attempt errors joined, got %v", err)
+	}
+	if res.Attempts != 3 || res.Elapsed <= 0 || len(delayList) != 2 {
+		t.Errorf("Expected 3 attempts and 2 retries, got %+v %v", res, delayList)
+	}
+
+	res, err = retryHelper.DoRetryResult(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return "ok", nil
+	})
+	if err != nil || res.Ret != "ok" || res.Attempts != 1 {
+		t.Errorf("Expected success on 1st attempt, got %+v %v", res, err)
+	}
+
+	familyList, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	eventMap := make(map[string]float64)
+	for _, family := range familyList {
+		if family.GetName() != "test_retry_event" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "event" {
+					eventMap[label.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if eventMap["retry"] != 2 || eventMap["failed"] != 1 || eventMap["succeeded"] != 1 {
+		t.Errorf("Unexpected metrics %v", eventMap)
+	}
+}
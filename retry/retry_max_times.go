@@ -1,9 +1,10 @@
 package retry
 
 import (
+	"context"
 	"errors"
-	"golang.org/x/exp/rand"
 	"math"
+	"math/rand"
 	"time"
 )
 
@@ -12,13 +13,25 @@ type MaxTimes struct {
 	RetryTimeout  time.Duration
 	MaxDelay      time.Duration
 	IsExponential bool
+	//AttemptTimeout 单次执行的超时, 0 表示不限制
+	AttemptTimeout time.Duration
+	//RetryIf 为空时所有错误都重试
+	RetryIf Classifier
+	//Name 不为空时上报指标, 见 GetMetricCollectors
+	Name string
+	//OnRetry 每次重试前回调, attempt 为已执行的次数
+	OnRetry func(attempt int, err error, nextDelay time.Duration)
 }
 
 type MaxTimesOption struct {
-	MaxTimes      int
-	RetryTimeout  time.Duration
-	MaxDelay      time.Duration
-	IsExponential bool
+	MaxTimes       int
+	RetryTimeout   time.Duration
+	MaxDelay       time.Duration
+	IsExponential  bool
+	AttemptTimeout time.Duration
+	RetryIf        Classifier
+	Name           string
+	OnRetry        func(attempt int, err error, nextDelay time.Duration)
 }
 
 func (m *MaxTimesOption) Apply(ins Interface) {
@@ -38,6 +51,22 @@ func (m *MaxTimesOption) Apply(ins Interface) {
 		if !m.IsExponential {
 			v.IsExponential = m.IsExponential
 		}
+
+		if m.AttemptTimeout > 0 {
+			v.AttemptTimeout = m.AttemptTimeout
+		}
+
+		if m.RetryIf != nil {
+			v.RetryIf = m.RetryIf
+		}
+
+		if m.Name != "" {
+			v.Name = m.Name
+		}
+
+		if m.OnRetry != nil {
+			v.OnRetry = m.OnRetry
+		}
 	}
 }
 func WithMaxTimesMaxTimes(maxTimes int) OptionFn {
@@ -72,6 +101,42 @@ func WithMaxTimesIsExponential(isExponential bool) OptionFn {
 	}
 }
 
+// WithMaxTimesAttemptTimeout 单次执行的超时, 只对 DoRetryCtx/DoRetryReturnCtx 和 KeyedRetry 生效
+func WithMaxTimesAttemptTimeout(attemptTimeout time.Duration) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*MaxTimesOption); ok {
+			v.AttemptTimeout = attemptTimeout
+		}
+	}
+}
+
+// WithMaxTimesRetryIf 只重试 retryIf 返回 true 的错误, 比如 RetryOn(ErrTimeout)
+func WithMaxTimesRetryIf(retryIf Classifier) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*MaxTimesOption); ok {
+			v.RetryIf = retryIf
+		}
+	}
+}
+
+// WithMaxTimesName 重试策略的名字, 用于上报指标
+func WithMaxTimesName(name string) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*MaxTimesOption); ok {
+			v.Name = name
+		}
+	}
+}
+
+// WithMaxTimesOnRetry 每次重试前回调, 比如记录日志
+func WithMaxTimesOnRetry(onRetry func(attempt int, err error, nextDelay time.Duration)) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*MaxTimesOption); ok {
+			v.OnRetry = onRetry
+		}
+	}
+}
+
 func NewMaxTimes(maxTimes int, retryTimeout, maxDelay time.Duration, isExponential bool) *MaxTimes {
 	return &MaxTimes{
 		MaxTimes:      maxTimes,
@@ -82,37 +147,57 @@ func NewMaxTimes(maxTimes int, retryTimeout, maxDelay time.Duration, isExponenti
 }
 
 func (m *MaxTimes) DoRetry(fn func() error) error {
-	var err error
-	retryTimes := 1
-	for i := 0; i < m.MaxTimes; i++ {
-		time.Sleep(m.getRetryTimeout(retryTimes))
-		if err = fn(); err != nil {
-			retryTimes++
-			continue
-		}
-		return nil
-	}
+	return m.DoRetryCtx(context.Background(), func(ctx context.Context) error {
+		return fn()
+	})
+}
+
+func (m *MaxTimes) DoRetryCtx(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := m.DoRetryReturnCtx(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(ctx)
+	})
 	return err
 }
 
-func (u *MaxTimes) DoRetryWithParams(key string, params ...any) error {
-	return errors.New("this kind strategy not support retry with params")
+// DoRetryWithParams 持久化的重试使用 NewKeyedRetry
+func (m *MaxTimes) DoRetryWithParams(key string, params ...any) error {
+	return errors.New("this kind strategy not support retry with params, use KeyedRetry")
 }
 
 func (m *MaxTimes) DoRetryReturn(fn func() (interface{}, error)) (interface{}, error) {
-	var err error
-	var ret interface{}
-	retryTimes := 1
-	for i := 0; i < m.MaxTimes; i++ {
-		time.Sleep(m.getRetryTimeout(retryTimes))
-		if ret, err = fn(); err != nil {
-			retryTimes++
-			continue
-		} else {
-			return ret, nil
-		}
+	return m.DoRetryReturnCtx(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// DoRetryReturnCtx 第一次立即执行, 失败后等待重试间隔, ctx 取消后不再等待和执行
+func (m *MaxTimes) DoRetryReturnCtx(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	res, err := doRetry(ctx, m.AttemptTimeout, m, fn)
+	return res.Ret, err
+}
+
+func (m *MaxTimes) DoRetryResult(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (*Result, error) {
+	return doRetry(ctx, m.AttemptTimeout, m, fn)
+}
+
+// next 执行 MaxTimes 次后不再重试
+func (m *MaxTimes) next(retryTimes int, elapsed time.Duration, lastErr error) (time.Duration, bool) {
+	if retryTimes >= m.MaxTimes {
+		return 0, false
 	}
-	return ret, err
+	return nextDelay(lastErr, m.getRetryTimeout(retryTimes+1)), true
+}
+
+func (m *MaxTimes) classifier() Classifier {
+	return m.RetryIf
+}
+
+func (m *MaxTimes) attemptTimeout() time.Duration {
+	return m.AttemptTimeout
+}
+
+func (m *MaxTimes) hook() hook {
+	return hook{name: m.Name, onRetry: m.OnRetry}
 }
 
 func (m *MaxTimes) getRetryTimeout(retryTimes int) time.Duration {
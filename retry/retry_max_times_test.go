@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"math"
 	"testing"
@@ -110,3 +111,55 @@ func TestGetRetryTimeout_FixedDelay2(t *testing.T) {
 		t.Errorf("Expected fixed timeout of %v, got %v", 50*time.Millisecond, timeout)
 	}
 }
+
+func TestDoRetryCtx_NoInitialSleep(t *testing.T) {
+	maxTimes := NewMaxTimes(3, 100*time.Millisecond, 0, false)
+	st := time.Now()
+	err := maxTimes.DoRetryCtx(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if time.Since(st) >= 100*time.Millisecond {
+		t.Errorf("Expected first attempt without delay, got %v", time.Since(st))
+	}
+}
+
+func TestDoRetryCtx_Cancel(t *testing.T) {
+	maxTimes := NewMaxTimes(3, time.Second, 0, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	st := time.Now()
+	err := maxTimes.DoRetryCtx(ctx, func(ctx context.Context) error {
+		attempts++
+		return errors.New("test error")
+	})
+	if time.Since(st) >= time.Second {
+		t.Errorf("Expected return on cancel, got %v", time.Since(st))
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || attempts != 1 {
+		t.Errorf("Expected deadline exceeded after 1 attempt, got %v %d", err, attempts)
+	}
+}
+
+func TestDoRetryReturnCtx_AttemptTimeout(t *testing.T) {
+	maxTimes, err := GetRetryHelper(RetryMaxTimes, WithMaxTimesMaxTimes(3), WithMaxTimesRetryTimeout(time.Millisecond), WithMaxTimesIsExponential(false), WithMaxTimesAttemptTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	attempts := 0
+	ret, err := maxTimes.DoRetryReturnCtx(context.Background(), func(ctx context.Context) (interface{}, error) {
+		attempts++
+		if attempts < 3 {
+			//前两次等到单次超时
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "success", nil
+	})
+	if err != nil || ret != "success" || attempts != 3 {
+		t.Errorf("Expected success on 3rd attempt, got %v %v %d", ret, err, attempts)
+	}
+}
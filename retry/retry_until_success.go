@@ -0,0 +1,257 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// defaultUntilSuccessMaxDelay MaxDelay 小于等于 0 时重试间隔的上限
+const defaultUntilSuccessMaxDelay = 10 * time.Second
+
+// UntilSuccess 一直重试直到成功, 总耗时超过 MaxElapsed 或 ctx 取消后返回每次的错误
+type UntilSuccess struct {
+	RetryTimeout time.Duration
+	//MaxDelay 小于等于 0 时使用 defaultUntilSuccessMaxDelay
+	MaxDelay      time.Duration
+	IsExponential bool
+	//IsJitter 重试间隔在 [interval/2, interval) 之间随机, 避免同时重试
+	IsJitter bool
+	//MaxElapsed 总耗时上限, 最后一次执行的 ctx 也会在到达上限时取消, 小于 0 表示不限制, 只能通过 ctx 取消
+	MaxElapsed time.Duration
+	//AttemptTimeout 单次执行的超时, 0 表示不限制
+	AttemptTimeout time.Duration
+	//RetryIf 为空时所有错误都重试
+	RetryIf Classifier
+	//Name 不为空时上报指标, 见 GetMetricCollectors
+	Name string
+	//OnRetry 每次重试前回调, attempt 为已执行的次数
+	OnRetry func(attempt int, err error, nextDelay time.Duration)
+}
+
+func NewUntilSuccess(retryTimeout, maxDelay, maxElapsed time.Duration, isExponential, isJitter bool) *UntilSuccess {
+	return &UntilSuccess{
+		RetryTimeout:  retryTimeout,
+		MaxDelay:      maxDelay,
+		IsExponential: isExponential,
+		IsJitter:      isJitter,
+		MaxElapsed:    maxElapsed,
+	}
+}
+
+type UntilSuccessOption struct {
+	RetryTimeout   time.Duration
+	MaxDelay       time.Duration
+	IsExponential  bool
+	IsJitter       bool
+	MaxElapsed     time.Duration
+	AttemptTimeout time.Duration
+	RetryIf        Classifier
+	Name           string
+	OnRetry        func(attempt int, err error, nextDelay time.Duration)
+}
+
+func (u *UntilSuccessOption) Apply(ins Interface) {
+	if v, ok := ins.(*UntilSuccess); ok {
+		if u.RetryTimeout > 0 {
+			v.RetryTimeout = u.RetryTimeout
+		}
+
+		if u.MaxDelay > 0 {
+			v.MaxDelay = u.MaxDelay
+		}
+
+		v.IsExponential = u.IsExponential
+		v.IsJitter = u.IsJitter
+
+		if u.MaxElapsed != 0 {
+			v.MaxElapsed = u.MaxElapsed
+		}
+
+		if u.AttemptTimeout > 0 {
+			v.AttemptTimeout = u.AttemptTimeout
+		}
+
+		if u.RetryIf != nil {
+			v.RetryIf = u.RetryIf
+		}
+
+		if u.Name != "" {
+			v.Name = u.Name
+		}
+
+		if u.OnRetry != nil {
+			v.OnRetry = u.OnRetry
+		}
+	}
+}
+
+// WithUntilSuccessRetryTimeout 第一次重试的间隔, 指数退避时之后每次翻倍
+func WithUntilSuccessRetryTimeout(retryTimeout time.Duration) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.RetryTimeout = retryTimeout
+		}
+	}
+}
+
+// WithUntilSuccessMaxDelay 重试间隔的上限
+func WithUntilSuccessMaxDelay(maxDelay time.Duration) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.MaxDelay = maxDelay
+		}
+	}
+}
+
+func WithUntilSuccessIsExponential(isExponential bool) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.IsExponential = isExponential
+		}
+	}
+}
+
+func WithUntilSuccessIsJitter(isJitter bool) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.IsJitter = isJitter
+		}
+	}
+}
+
+// WithUntilSuccessMaxElapsed 总耗时上限, 下一次重试会超过上限时不再重试, 小于 0 表示不限制
+func WithUntilSuccessMaxElapsed(maxElapsed time.Duration) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.MaxElapsed = maxElapsed
+		}
+	}
+}
+
+// WithUntilSuccessAttemptTimeout 单次执行的超时, 只对 DoRetryCtx/DoRetryReturnCtx 和 KeyedRetry 生效
+func WithUntilSuccessAttemptTimeout(attemptTimeout time.Duration) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.AttemptTimeout = attemptTimeout
+		}
+	}
+}
+
+// WithUntilSuccessRetryIf 只重试 retryIf 返回 true 的错误, 比如 RetryOn(ErrTimeout)
+func WithUntilSuccessRetryIf(retryIf Classifier) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.RetryIf = retryIf
+		}
+	}
+}
+
+// WithUntilSuccessName 重试策略的名字, 用于上报指标
+func WithUntilSuccessName(name string) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.Name = name
+		}
+	}
+}
+
+// WithUntilSuccessOnRetry 每次重试前回调, 比如记录日志
+func WithUntilSuccessOnRetry(onRetry func(attempt int, err error, nextDelay time.Duration)) OptionFn {
+	return func(option OptionsInterface) {
+		if v, ok := option.(*UntilSuccessOption); ok {
+			v.OnRetry = onRetry
+		}
+	}
+}
+
+// DoRetryWithParams 持久化的重试使用 NewKeyedRetry
+func (u *UntilSuccess) DoRetryWithParams(key string, params ...any) error {
+	return errors.New("this kind strategy not support retry with params, use KeyedRetry")
+}
+
+func (u *UntilSuccess) DoRetry(fn func() error) error {
+	return u.DoRetryCtx(context.Background(), func(ctx context.Context) error {
+		return fn()
+	})
+}
+
+func (u *UntilSuccess) DoRetryReturn(fn func() (interface{}, error)) (interface{}, error) {
+	return u.DoRetryReturnCtx(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+func (u *UntilSuccess) DoRetryCtx(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := u.DoRetryReturnCtx(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+func (u *UntilSuccess) DoRetryReturnCtx(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	res, err := doRetry(ctx, u.AttemptTimeout, u, u.withDeadline(fn))
+	return res.Ret, err
+}
+
+func (u *UntilSuccess) DoRetryResult(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (*Result, error) {
+	return doRetry(ctx, u.AttemptTimeout, u, u.withDeadline(fn))
+}
+
+// withDeadline 每次执行的 ctx 带上 MaxElapsed 的截止时间, 避免最后一次执行超过总耗时上限
+// 只限制执行, 外层 ctx 不变, 到达上限时仍返回执行的错误
+func (u *UntilSuccess) withDeadline(fn func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error) {
+	if u.MaxElapsed <= 0 {
+		return fn
+	}
+	deadline := time.Now().Add(u.MaxElapsed)
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		return fn(ctx)
+	}
+}
+
+// next 下一次重试会超过 MaxElapsed 时不再重试
+func (u *UntilSuccess) next(retryTimes int, elapsed time.Duration, lastErr error) (time.Duration, bool) {
+	delay := nextDelay(lastErr, u.getRetryTimeout(retryTimes))
+	if u.MaxElapsed > 0 && elapsed+delay > u.MaxElapsed {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (u *UntilSuccess) classifier() Classifier {
+	return u.RetryIf
+}
+
+func (u *UntilSuccess) attemptTimeout() time.Duration {
+	return u.AttemptTimeout
+}
+
+func (u *UntilSuccess) hook() hook {
+	return hook{name: u.Name, onRetry: u.OnRetry}
+}
+
+// getRetryTimeout 第 retryTimes 次重试前的间隔, 先限制上限再加抖动
+func (u *UntilSuccess) getRetryTimeout(retryTimes int) time.Duration {
+	maxDelay := u.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultUntilSuccessMaxDelay
+	}
+	timeout := u.RetryTimeout
+	if u.IsExponential {
+		//逐次翻倍, 到达上限就停止, 避免溢出
+		for i := 1; i < retryTimes && timeout > 0 && timeout < maxDelay; i++ {
+			timeout *= 2
+		}
+	}
+	if timeout > maxDelay {
+		timeout = maxDelay
+	}
+	if u.IsJitter && timeout > 1 {
+		timeout = timeout/2 + time.Duration(rand.Int63n(int64(timeout/2)))
+	}
+	return timeout
+}
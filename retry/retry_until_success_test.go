@@ -0,0 +1,103 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUntilSuccess_Registered(t *testing.T) {
+	retryHelper, err := GetRetryHelper(RetryUntilSuccess)
+	if err != nil || retryHelper == nil {
+		t.Fatalf("Expected registered strategy, got %v", err)
+	}
+	ins := retryHelper.(*UntilSuccess)
+	if !ins.IsExponential || !ins.IsJitter || ins.MaxElapsed != time.Minute {
+		t.Errorf("Expected default options, got %+v", ins)
+	}
+}
+
+func TestUntilSuccess_DoRetry(t *testing.T) {
+	retryHelper, err := GetRetryHelper(RetryUntilSuccess, WithUntilSuccessRetryTimeout(time.Millisecond), WithUntilSuccessIsJitter(false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	attempts := 0
+	ret, err := retryHelper.DoRetryReturn(func() (interface{}, error) {
+		attempts++
+		if attempts < 5 {
+			return nil, errors.New("test error")
+		}
+		return "success", nil
+	})
+	if err != nil || ret != "success" || attempts != 5 {
+		t.Errorf("Expected success on 5th attempt, got %v %v %d", ret, err, attempts)
+	}
+}
+
+func TestUntilSuccess_MaxElapsed(t *testing.T) {
+	retryHelper, err := GetRetryHelper(RetryUntilSuccess,
+		WithUntilSuccessRetryTimeout(10*time.Millisecond),
+		WithUntilSuccessIsExponential(false),
+		WithUntilSuccessMaxElapsed(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	st := time.Now()
+	testErr := errors.New("test error")
+	err = retryHelper.DoRetry(func() error {
+		return testErr
+	})
+	if !errors.Is(err, testErr) {
+		t.Errorf("Expected joined errors, got %v", err)
+	}
+	if time.Since(st) > 150*time.Millisecond {
+		t.Errorf("Expected stop within max elapsed, got %v", time.Since(st))
+	}
+
+	//执行中到达上限时取消这一次执行
+	st = time.Now()
+	err = retryHelper.DoRetryCtx(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(st) > 150*time.Millisecond {
+		t.Errorf("Expected attempt cancelled at max elapsed, got %v after %v", err, time.Since(st))
+	}
+}
+
+func TestUntilSuccess_Cancel(t *testing.T) {
+	retryHelper, err := GetRetryHelper(RetryUntilSuccess, WithUntilSuccessRetryTimeout(10*time.Millisecond), WithUntilSuccessMaxElapsed(-1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = retryHelper.DoRetryCtx(ctx, func(ctx context.Context) error {
+		return errors.New("test error")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestUntilSuccess_GetRetryTimeout(t *testing.T) {
+	ins := NewUntilSuccess(100*time.Millisecond, time.Second, time.Minute, true, false)
+	if timeout := ins.getRetryTimeout(3); timeout != 400*time.Millisecond {
+		t.Errorf("Expected 400ms, got %v", timeout)
+	}
+	if timeout := ins.getRetryTimeout(100); timeout != time.Second {
+		t.Errorf("Expected capped to 1s, got %v", timeout)
+	}
+	//没有设置上限时不会溢出
+	ins = NewUntilSuccess(5*time.Second, 0, time.Minute, true, false)
+	if timeout := ins.getRetryTimeout(40); timeout != defaultUntilSuccessMaxDelay {
+		t.Errorf("Expected default max delay, got %v", timeout)
+	}
+	ins.MaxDelay = time.Second
+	ins.IsJitter = true
+	if timeout := ins.getRetryTimeout(100); timeout < 500*time.Millisecond || timeout >= time.Second {
+		t.Errorf("Expected jitter in [500ms, 1s), got %v", timeout)
+	}
+}
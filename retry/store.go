@@ -0,0 +1,170 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store 持久化 KeyedRetry 的任务
+type Store interface {
+	// Save 新增或更新任务
+	Save(ctx context.Context, task *RetryTask) error
+	// Claim 取出 NextAt 已到期的任务, 同时把 NextAt 推迟 lease, 避免多个进程重复执行
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*RetryTask, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore 进程内存储, 进程退出后丢失
+type MemoryStore struct {
+	lock    sync.Mutex
+	taskMap map[string]*RetryTask
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		taskMap: make(map[string]*RetryTask),
+	}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, task *RetryTask) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.save(task)
+	return nil
+}
+
+func (s *MemoryStore) save(task *RetryTask) {
+	t := *task
+	s.taskMap[task.ID] = &t
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*RetryTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.claim(now, lease, limit), nil
+}
+
+// claim 按 NextAt 从早到晚取出
+func (s *MemoryStore) claim(now time.Time, lease time.Duration, limit int) []*RetryTask {
+	dueList := make([]*RetryTask, 0)
+	for _, task := range s.taskMap {
+		if task.NextAt <= now.UnixMilli() {
+			dueList = append(dueList, task)
+		}
+	}
+	sort.Slice(dueList, func(i, j int) bool {
+		return dueList[i].NextAt < dueList[j].NextAt
+	})
+	if limit > 0 && len(dueList) > limit {
+		dueList = dueList[:limit]
+	}
+	taskList := make([]*RetryTask, 0, len(dueList))
+	for _, task := range dueList {
+		t := *task
+		taskList = append(taskList, &t)
+		task.NextAt = now.Add(lease).UnixMilli()
+	}
+	return taskList
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.taskMap, id)
+	return nil
+}
+
+func (s *MemoryStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.taskMap)
+}
+
+// FileStore 单进程的文件存储, 每次修改后把所有任务写入临时文件再重命名
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: MemoryStore{taskMap: make(map[string]*RetryTask)},
+		path:        path,
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	taskList := make([]*RetryTask, 0)
+	if err := json.Unmarshal(data, &taskList); err != nil {
+		return nil, err
+	}
+	for _, task := range taskList {
+		s.taskMap[task.ID] = task
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, task *RetryTask) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.save(task)
+	return s.flush()
+}
+
+func (s *FileStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*RetryTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	taskList := s.claim(now, lease, limit)
+	if len(taskList) == 0 {
+		return taskList, nil
+	}
+	return taskList, s.flush()
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.taskMap[id]; !ok {
+		return nil
+	}
+	delete(s.taskMap, id)
+	return s.flush()
+}
+
+// flush 调用方持有 lock
+func (s *FileStore) flush() error {
+	taskList := make([]*RetryTask, 0, len(s.taskMap))
+	for _, task := range s.taskMap {
+		taskList = append(taskList, task)
+	}
+	data, err := json.Marshal(taskList)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
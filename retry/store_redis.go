@@ -0,0 +1,114 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component"
+	"strings"
+	"time"
+)
+
+// redisSaveScript KEYS[1] 按 NextAt 排序的 zset KEYS[2] 任务(hash) ARGV[1] 任务 ID ARGV[2] NextAt ARGV[3] 任务
+const redisSaveScript = `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`
+
+// redisClaimScript KEYS 同 redisSaveScript, ARGV[1] 当前毫秒 ARGV[2] lease 到期毫秒 ARGV[3] 数量
+const redisClaimScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+local tasks = {}
+for _, id in ipairs(ids) do
+	local task = redis.call('HGET', KEYS[2], id)
+	if task then
+		redis.call('ZADD', KEYS[1], ARGV[2], id)
+		table.insert(tasks, task)
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return tasks
+`
+
+// redisDeleteScript KEYS 同 redisSaveScript, ARGV[1] 任务 ID
+const redisDeleteScript = `
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`
+
+// RedisStore 多个进程可以同时 Run, 通过 lease 避免重复执行
+// key 没有 hash tag 时整个 key 作为 hash tag, 脚本操作的两个 key 在 cluster 的同一个 slot
+type RedisStore struct {
+	conn component.RedisInterface
+	key  string
+}
+
+func NewRedisStore(conn component.RedisInterface, key string) *RedisStore {
+	return &RedisStore{
+		conn: conn,
+		key:  redisHashTag(key),
+	}
+}
+
+// redisHashTag key 已有 hash tag 时原样返回, 否则整个 key 作为 hash tag
+func redisHashTag(key string) string {
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key
+		}
+	}
+	if strings.Contains(key, "}") {
+		//无法加 hash tag, 非 cluster 下不受影响
+		return key
+	}
+	return "{" + key + "}"
+}
+
+func (s *RedisStore) keyList() []string {
+	return []string{s.key, s.key + ":task"}
+}
+
+func (s *RedisStore) Save(ctx context.Context, task *RetryTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Eval(ctx, redisSaveScript, s.keyList(), task.ID, task.NextAt, string(data))
+	return err
+}
+
+func (s *RedisStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*RetryTask, error) {
+	reply, err := s.conn.Eval(ctx, redisClaimScript, s.keyList(), now.UnixMilli(), now.Add(lease).UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	replyList, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("redis retry store claim reply %v not support", reply))
+	}
+	taskList := make([]*RetryTask, 0, len(replyList))
+	for _, v := range replyList {
+		raw, ok := v.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("redis retry store claim reply %v not support", reply))
+		}
+		task := &RetryTask{}
+		if err := json.Unmarshal([]byte(raw), task); err != nil {
+			return nil, err
+		}
+		taskList = append(taskList, task)
+	}
+	return taskList, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	_, err := s.conn.Eval(ctx, redisDeleteScript, s.keyList(), id)
+	return err
+}
@@ -0,0 +1,202 @@
+package taskpool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultBatchRetention 默认保留最近的批次数
+const defaultBatchRetention = 100
+
+// Batch 一次 Start 的结果, 多次 Start 之间互不影响
+// 执行中也可以读取, 返回的是当前结果的副本
+type Batch struct {
+	ID   string
+	lock sync.Mutex
+	//以下由 lock 保护
+	errList     map[string]error
+	retList     map[string]interface{}
+	statusList  map[string]TaskStatus
+	attemptList map[string]int
+	//resultList 按 AddTask 的顺序, idMap 任务 ID 在 resultList 中的位置
+	resultList []TaskResult
+	idMap      map[string]int
+	progress   Progress
+	//firstErr 按时间最先失败的任务
+	firstErrLabel string
+	firstErr      error
+}
+
+// newBatch 记录任务在这一批中的位置, 结果先设为 TaskStatusPending
+func newBatch(id string, taskList []*task) *Batch {
+	b := &Batch{
+		ID:          id,
+		errList:     make(map[string]error),
+		retList:     make(map[string]interface{}),
+		statusList:  make(map[string]TaskStatus),
+		attemptList: make(map[string]int),
+		resultList:  make([]TaskResult, len(taskList)),
+		idMap:       make(map[string]int, len(taskList)),
+		progress:    Progress{Total: len(taskList)},
+	}
+	for i, task := range taskList {
+		task.index = i
+		b.idMap[task.id] = i
+		b.resultList[i] = TaskResult{
+			BatchID:  id,
+			ID:       task.id,
+			Label:    task.label,
+			TaskType: task.taskType,
+			Status:   TaskStatusPending,
+		}
+	}
+	return b
+}
+
+// GetResultList 按 AddTask 的顺序返回, label 重复的任务也各自保留结果
+func (b *Batch) GetResultList() []TaskResult {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	resultList := make([]TaskResult, len(b.resultList))
+	copy(resultList, b.resultList)
+	return resultList
+}
+
+// GetResult 按 AddTask 返回的任务 ID 获取结果
+func (b *Batch) GetResult(id string) (TaskResult, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	i, ok := b.idMap[id]
+	if !ok {
+		return TaskResult{}, false
+	}
+	return b.resultList[i], true
+}
+
+func (b *Batch) GetRetList() map[string]interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	retList := make(map[string]interface{}, len(b.retList))
+	for k, v := range b.retList {
+		retList[k] = v
+	}
+	return retList
+}
+
+func (b *Batch) GetErrList() map[string]error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	errList := make(map[string]error, len(b.errList))
+	for k, v := range b.errList {
+		errList[k] = v
+	}
+	return errList
+}
+
+// GetStatusList 每个任务的状态
+func (b *Batch) GetStatusList() map[string]TaskStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	statusList := make(map[string]TaskStatus, len(b.statusList))
+	for k, v := range b.statusList {
+		statusList[k] = v
+	}
+	return statusList
+}
+
+// GetAttemptList 每个任务执行的次数, 没有执行的任务为 0
+func (b *Batch) GetAttemptList() map[string]int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	attemptList := make(map[string]int, len(b.attemptList))
+	for k, v := range b.attemptList {
+		attemptList[k] = v
+	}
+	return attemptList
+}
+
+func (b *Batch) GetProgress() Progress {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.progress
+}
+
+// FirstErr 优先返回最先失败的任务的错误
+func (b *Batch) FirstErr() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.firstErr != nil {
+		return errors.New(fmt.Sprintf("key %s : %s", b.firstErrLabel, b.firstErr.Error()))
+	}
+	for key, err := range b.errList {
+		if err != nil {
+			return errors.New(fmt.Sprintf("key %s : %s", key, err.Error()))
+		}
+	}
+	return nil
+}
+
+// StartBatch 同 Start, 返回这一批的结果
+// 执行中 AddTask 的任务不会加入这一批, 留到下一次 Start
+func (t *TaskPool) StartBatch() (*Batch, error) {
+	run, err := t.prepare()
+	if err != nil {
+		return nil, err
+	}
+	t.run(run)
+	t.checkRePanic(run)
+	return run.batch, nil
+}
+
+// GetBatch 按批次 ID 获取结果, Clear, RemoveBatch 或超过保留数被删除后获取不到
+func (t *TaskPool) GetBatch(id string) (*Batch, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	batch, ok := t.batchMap[id]
+	return batch, ok
+}
+
+// LastBatch 最近一次开始执行的批次, GetRetList 等方法返回这一批的结果
+func (t *TaskPool) LastBatch() *Batch {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.batch
+}
+
+// RemoveBatch 不再需要的批次及时删除, 避免长期复用时占用内存
+func (t *TaskPool) RemoveBatch(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.batchMap[id]; !ok {
+		return
+	}
+	delete(t.batchMap, id)
+	for i, batchID := range t.batchIDList {
+		if batchID == id {
+			t.batchIDList = append(t.batchIDList[:i], t.batchIDList[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetBatchRetention 最多保留的批次数, 默认 100, 超过时删除最早的批次, 小于等于 0 表示不限制
+// 已经拿到的 *Batch 不受影响, 只是不能再通过 GetBatch 获取
+func (t *TaskPool) SetBatchRetention(n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.batchRetention = n
+	t.trimBatch()
+}
+
+// trimBatch 调用方持有 t.lock
+func (t *TaskPool) trimBatch() {
+	if t.batchRetention <= 0 || len(t.batchIDList) <= t.batchRetention {
+		return
+	}
+	n := len(t.batchIDList) - t.batchRetention
+	for _, id := range t.batchIDList[:n] {
+		delete(t.batchMap, id)
+	}
+	t.batchIDList = append([]string(nil), t.batchIDList[n:]...)
+}
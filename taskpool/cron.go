@@ -0,0 +1,217 @@
+package taskpool
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField 每个字段的取值范围
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronField{min: 0, max: 59}
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{min: 0, max: 6, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptorMap = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// CronSchedule cron 表达式, 每个字段用位图表示
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	//domStar/dowStar 日和星期都有限制时满足其一即可
+	domStar, dowStar bool
+	loc              *time.Location
+}
+
+// ParseCron 解析 cron 表达式, 按本地时区计算
+// 支持 5 个字段(分 时 日 月 星期)或 6 个字段(秒 分 时 日 月 星期), 以及 @daily/@hourly 等
+// 每个字段支持 * ? 数字 范围 a-b 步长 /n 列表 a,b 以及月份和星期的英文缩写, 星期 7 等同于 0
+func ParseCron(spec string) (*CronSchedule, error) {
+	return ParseCronInLocation(spec, time.Local)
+}
+
+func ParseCronInLocation(spec string, loc *time.Location) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if descriptor, ok := cronDescriptorMap[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+	fieldList := strings.Fields(spec)
+	switch len(fieldList) {
+	case 5:
+		fieldList = append([]string{"0"}, fieldList...)
+	case 6:
+	default:
+		return nil, errors.New(fmt.Sprintf("cron %q 需要 5 或 6 个字段", spec))
+	}
+
+	c := &CronSchedule{loc: loc}
+	var err error
+	if c.second, err = parseCronField(fieldList[0], cronSecond); err != nil {
+		return nil, err
+	}
+	if c.minute, err = parseCronField(fieldList[1], cronMinute); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fieldList[2], cronHour); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fieldList[3], cronDom); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fieldList[4], cronMonth); err != nil {
+		return nil, err
+	}
+	//星期允许 7 表示周日
+	dowField := cronDow
+	dowField.max = 7
+	if c.dow, err = parseCronField(fieldList[5], dowField); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domStar = isCronStar(fieldList[3])
+	c.dowStar = isCronStar(fieldList[5])
+	return c, nil
+}
+
+func isCronStar(expr string) bool {
+	return expr == "*" || expr == "?"
+}
+
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangeExpr = part[:idx]
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return 0, errors.New(fmt.Sprintf("cron 字段 %q 步长不合法", part))
+			}
+		}
+
+		start, end := field.min, field.max
+		switch {
+		case isCronStar(rangeExpr):
+		case strings.Contains(rangeExpr, "-"):
+			bound := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if start, err = parseCronValue(bound[0], field); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(bound[1], field); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangeExpr, field); err != nil {
+				return 0, err
+			}
+			//单个值带步长时表示从这个值到最大值
+			end = start
+			if step > 1 {
+				end = field.max
+			}
+		}
+		if start > end {
+			return 0, errors.New(fmt.Sprintf("cron 字段 %q 范围不合法", part))
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(expr string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < field.min || v > field.max {
+		return 0, errors.New(fmt.Sprintf("cron 值 %q 不在 %d-%d 之间", expr, field.min, field.max))
+	}
+	return v, nil
+}
+
+// Next 大于 t 的下一个时间, 5 年内没有时返回零值
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(c.loc).Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for c.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !c.dayMatch(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for c.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for c.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for c.second&(1<<uint(t.Second())) == 0 {
+		t = t.Truncate(time.Second).Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+func (c *CronSchedule) dayMatch(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,154 @@
+package taskpool
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DepRetListKey AddTaskWithDeps 时依赖任务的结果放在参数的这个 key 下, 类型为 map[string]interface{}
+const DepRetListKey = "dep_ret_list"
+
+// ErrDependencyFailed 依赖的任务没有成功, 任务被跳过
+var ErrDependencyFailed = errors.New("依赖的任务没有成功")
+
+// ErrDuplicateLabel SetRejectDuplicateLabel 后或同一批有依赖时添加重复 label 的任务
+var ErrDuplicateLabel = errors.New("任务 label 重复")
+
+// taskGraph 任务依赖关系, 一次 Start 内使用
+type taskGraph struct {
+	//dependentMap 依赖某个 label 的任务
+	dependentMap map[string][]*task
+	//depCountMap 还没结束的依赖数
+	depCountMap map[*task]int
+}
+
+// AddTaskWithDeps 依赖的任务都成功后才执行, 依赖的结果通过 params[DepRetListKey] 传入
+// 依赖的任务失败/取消/跳过时这个任务记为 TaskStatusSkipped
+// 依赖按 label 查找, 同一批中已有重复的 label 时返回 ErrDuplicateLabel
+func (t *TaskPool) AddTaskWithDeps(taskType TaskType, label string, params map[string]interface{}, depList ...string) (string, error) {
+	return t.addTaskWithDeps(taskType, label, params, func(depRetList map[string]interface{}) interface{} {
+		p := make(map[string]interface{}, len(params)+1)
+		for k, v := range params {
+			p[k] = v
+		}
+		p[DepRetListKey] = depRetList
+		return p
+	}, depList)
+}
+
+func (t *TaskPool) addTaskWithDeps(taskType TaskType, label string, params interface{}, buildParams func(depRetList map[string]interface{}) interface{}, depList []string) (string, error) {
+	task := &task{taskType: taskType, label: label, params: params}
+	if len(depList) > 0 {
+		seen := make(map[string]bool, len(depList))
+		for _, dep := range depList {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			task.depList = append(task.depList, dep)
+		}
+		task.buildParams = buildParams
+	}
+	return t.addTask(task)
+}
+
+// buildTaskGraph 检查依赖的任务是否存在以及是否有环
+// 依赖按 label 查找, 有任务声明了依赖时同一批的 label 不能重复
+func buildTaskGraph(taskList []*task) (*taskGraph, error) {
+	graph := &taskGraph{
+		dependentMap: make(map[string][]*task),
+		depCountMap:  make(map[*task]int),
+	}
+	hasDeps := false
+	labelMap := make(map[string]*task, len(taskList))
+	dupLabel := ""
+	for _, task := range taskList {
+		if _, ok := labelMap[task.label]; ok && dupLabel == "" {
+			dupLabel = task.label
+		}
+		labelMap[task.label] = task
+		hasDeps = hasDeps || len(task.depList) > 0
+	}
+	if hasDeps && dupLabel != "" {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateLabel, dupLabel)
+	}
+	for _, task := range taskList {
+		for _, dep := range task.depList {
+			if _, ok := labelMap[dep]; !ok {
+				return nil, errors.New(fmt.Sprintf("任务 %s 依赖的任务 %s 不存在", task.label, dep))
+			}
+			graph.dependentMap[dep] = append(graph.dependentMap[dep], task)
+		}
+		graph.depCountMap[task] = len(task.depList)
+	}
+
+	//拓扑排序 剩下的任务在环上或依赖环上的任务
+	countMap := make(map[*task]int, len(graph.depCountMap))
+	queue := make([]*task, 0, len(taskList))
+	for task, count := range graph.depCountMap {
+		countMap[task] = count
+		if count == 0 {
+			queue = append(queue, task)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		task := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, next := range graph.dependentMap[task.label] {
+			countMap[next]--
+			if countMap[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+	if visited < len(taskList) {
+		labelList := make([]string, 0)
+		for task, count := range countMap {
+			if count > 0 {
+				labelList = append(labelList, task.label)
+			}
+		}
+		sort.Strings(labelList)
+		return nil, errors.New(fmt.Sprintf("任务依赖存在环: %v", labelList))
+	}
+	return graph, nil
+}
+
+// releaseDependents 调用方持有 batch.lock, 依赖都成功的任务提交执行, 否则跳过
+func (t *TaskPool) releaseDependents(run *runState, doneTask *task, status TaskStatus) {
+	for _, next := range run.graph.dependentMap[doneTask.label] {
+		if run.doneMap[next] {
+			continue
+		}
+		if status != TaskStatusSucceeded {
+			err := fmt.Errorf("%w: %s", ErrDependencyFailed, doneTask.label)
+			run.batch.errList[next.label] = err
+			t.finish(run, next, nil, err, TaskStatusSkipped)
+			continue
+		}
+		run.graph.depCountMap[next]--
+		if run.graph.depCountMap[next] != 0 {
+			continue
+		}
+		run.wg.Add(1)
+		go func(next *task) {
+			defer run.wg.Done()
+			if err := t.submit(run, run.pool, next); err != nil {
+				t.recordErr(run, next, err)
+			}
+		}(next)
+	}
+}
+
+func (t *TaskPool) getDepRetList(run *runState, task *task) map[string]interface{} {
+	run.batch.lock.Lock()
+	defer run.batch.lock.Unlock()
+	depRetList := make(map[string]interface{}, len(task.depList))
+	for _, dep := range task.depList {
+		depRetList[dep] = run.batch.retList[dep]
+	}
+	return depRetList
+}
@@ -0,0 +1,341 @@
+package taskpool
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	fileOpPush    = "push"
+	fileOpPop     = "pop"
+	fileOpAck     = "ack"
+	fileOpNack    = "nack"
+	fileOpDead    = "dead"
+	fileOpDeadPop = "dead_pop"
+)
+
+// fileRecord 日志中的一行
+type fileRecord struct {
+	Op  string        `json:"op"`
+	Msg *QueueMessage `json:"msg,omitempty"`
+	ID  string        `json:"id,omitempty"`
+	//Deadline pop 时的可见性截止时间, 毫秒
+	Deadline int64 `json:"deadline,omitempty"`
+}
+
+type fileInflight struct {
+	msg      *QueueMessage
+	deadline time.Time
+}
+
+// FileQueue 基于追加写日志(WAL)的本地持久化队列, 打开时重放日志恢复状态
+// 崩溃前已投递但没有 Ack 的任务重启后重新投递
+type FileQueue struct {
+	opts     queueOptions
+	path     string
+	lock     sync.Mutex
+	file     *os.File
+	ready    *list.List
+	readyMap map[string]*list.Element
+	inflight map[string]*fileInflight
+	dead     *list.List
+	deadMap  map[string]*list.Element
+	//recordCount 日志中的记录数
+	recordCount int
+	//brokenErr 压缩替换日志后没能重新打开, 之后的写入都返回错误
+	brokenErr error
+}
+
+func NewFileQueue(path string, opts ...QueueOption) (*FileQueue, error) {
+	op := defaultQueueOptions()
+	for _, option := range opts {
+		option(&op)
+	}
+	q := &FileQueue{
+		opts:     op,
+		path:     path,
+		ready:    list.New(),
+		readyMap: make(map[string]*list.Element),
+		inflight: make(map[string]*fileInflight),
+		dead:     list.New(),
+		deadMap:  make(map[string]*list.Element),
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.replay(file); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	q.file = file
+	return q, nil
+}
+
+// replay 最后一行不完整时(写入中崩溃)截掉
+func (q *FileQueue) replay(file *os.File) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record := fileRecord{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return file.Truncate(offset)
+			}
+			return errors.New(fmt.Sprintf("file queue %s broken at offset %d: %s", q.path, offset, err.Error()))
+		}
+		q.apply(record)
+		q.recordCount++
+		offset += int64(len(line))
+	}
+}
+
+// apply 按记录修改内存中的状态, 写日志和重放共用
+func (q *FileQueue) apply(record fileRecord) {
+	switch record.Op {
+	case fileOpPush:
+		q.readyMap[record.Msg.ID] = q.ready.PushBack(record.Msg)
+	case fileOpPop:
+		q.remove(record.Msg.ID)
+		q.inflight[record.Msg.ID] = &fileInflight{
+			msg:      record.Msg,
+			deadline: time.UnixMilli(record.Deadline),
+		}
+	case fileOpAck:
+		q.remove(record.ID)
+	case fileOpNack:
+		if item, ok := q.inflight[record.ID]; ok {
+			delete(q.inflight, record.ID)
+			q.readyMap[record.ID] = q.ready.PushBack(item.msg)
+		}
+	case fileOpDead:
+		q.remove(record.Msg.ID)
+		q.deadMap[record.Msg.ID] = q.dead.PushBack(record.Msg)
+	case fileOpDeadPop:
+		if e, ok := q.deadMap[record.ID]; ok {
+			q.dead.Remove(e)
+			delete(q.deadMap, record.ID)
+		}
+	}
+}
+
+func (q *FileQueue) remove(id string) {
+	if e, ok := q.readyMap[id]; ok {
+		q.ready.Remove(e)
+		delete(q.readyMap, id)
+	}
+	delete(q.inflight, id)
+}
+
+// write 先写日志再修改内存, 调用方持有 lock
+func (q *FileQueue) write(record fileRecord) error {
+	if q.brokenErr != nil {
+		return errors.New(fmt.Sprintf("file queue %s broken: %s", q.path, q.brokenErr.Error()))
+	}
+	if q.file == nil {
+		return errors.New("file queue closed")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if q.opts.sync {
+		if err := q.file.Sync(); err != nil {
+			return err
+		}
+	}
+	q.apply(record)
+	q.recordCount++
+	//记录已经写入, 压缩失败不影响这次操作, 下次写入时再压缩
+	if err := q.compact(); err != nil {
+		component.Logger.Errorf(context.Background(), "taskpool file queue compact %s failed: %v", q.path, err)
+	}
+	return nil
+}
+
+// compact 按当前状态重写日志, 写临时文件后替换
+func (q *FileQueue) compact() error {
+	live := q.ready.Len() + len(q.inflight) + q.dead.Len()
+	if q.recordCount < q.opts.compactThreshold || q.recordCount < 2*live {
+		return nil
+	}
+
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	recordList := make([]fileRecord, 0, live)
+	for e := q.ready.Front(); e != nil; e = e.Next() {
+		recordList = append(recordList, fileRecord{Op: fileOpPush, Msg: e.Value.(*QueueMessage)})
+	}
+	for _, item := range q.inflight {
+		recordList = append(recordList, fileRecord{Op: fileOpPop, Msg: item.msg, Deadline: item.deadline.UnixMilli()})
+	}
+	for e := q.dead.Front(); e != nil; e = e.Next() {
+		recordList = append(recordList, fileRecord{Op: fileOpDead, Msg: e.Value.(*QueueMessage)})
+	}
+	for _, record := range recordList {
+		data, err := json.Marshal(record)
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		_, _ = writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		//旧文件已被替换, 继续写入会丢失
+		_ = q.file.Close()
+		q.file = nil
+		q.brokenErr = err
+		return err
+	}
+	_ = q.file.Close()
+	q.file = file
+	q.recordCount = len(recordList)
+	return nil
+}
+
+func (q *FileQueue) Push(ctx context.Context, msg *QueueMessage) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	clone := *msg
+	return q.write(fileRecord{Op: fileOpPush, Msg: &clone})
+}
+
+func (q *FileQueue) Pop(ctx context.Context) (*QueueMessage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	//可见性超时的任务重新投递
+	now := time.Now()
+	for id, item := range q.inflight {
+		if now.After(item.deadline) {
+			if err := q.write(fileRecord{Op: fileOpNack, ID: id}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for {
+		e := q.ready.Front()
+		if e == nil {
+			return nil, ErrQueueEmpty
+		}
+		msg := *e.Value.(*QueueMessage)
+		msg.Attempts++
+		if msg.Attempts > q.opts.maxAttempts {
+			if err := q.write(fileRecord{Op: fileOpDead, Msg: &msg}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deadline := now.Add(q.opts.visibilityTimeout)
+		if err := q.write(fileRecord{Op: fileOpPop, Msg: &msg, Deadline: deadline.UnixMilli()}); err != nil {
+			return nil, err
+		}
+		ret := msg
+		return &ret, nil
+	}
+}
+
+// Ack 可见性超时后才 Ack 的任务如果还没重新投递也一起删除
+func (q *FileQueue) Ack(ctx context.Context, msg *QueueMessage) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, inflight := q.inflight[msg.ID]
+	_, ready := q.readyMap[msg.ID]
+	if !inflight && !ready {
+		return nil
+	}
+	return q.write(fileRecord{Op: fileOpAck, ID: msg.ID})
+}
+
+func (q *FileQueue) Nack(ctx context.Context, msg *QueueMessage) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item, ok := q.inflight[msg.ID]
+	if !ok {
+		return nil
+	}
+	if item.msg.Attempts >= q.opts.maxAttempts {
+		return q.write(fileRecord{Op: fileOpDead, Msg: item.msg})
+	}
+	return q.write(fileRecord{Op: fileOpNack, ID: msg.ID})
+}
+
+func (q *FileQueue) PopDeadLetter(ctx context.Context) (*QueueMessage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	e := q.dead.Front()
+	if e == nil {
+		return nil, ErrQueueEmpty
+	}
+	msg := *e.Value.(*QueueMessage)
+	if err := q.write(fileRecord{Op: fileOpDeadPop, ID: msg.ID}); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Len 等待投递和执行中的任务数
+func (q *FileQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.ready.Len() + len(q.inflight)
+}
+
+func (q *FileQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
@@ -0,0 +1,156 @@
+package taskpool
+
+import (
+	"context"
+)
+
+// Group 带类型的任务池, 参数和结果不需要再做类型断言
+// 同样按 TaskType 分发到对应的处理函数, 底层为 TaskPool
+type Group[P any, R any] struct {
+	pool *TaskPool
+}
+
+func NewGroup[P any, R any](ctx context.Context) *Group[P, R] {
+	return &Group[P, R]{
+		pool: GetTaskPool(ctx),
+	}
+}
+
+// TaskPool 底层的任务池, 用于设置协程池/限速等
+func (g *Group[P, R]) TaskPool() *TaskPool {
+	return g.pool
+}
+
+func (g *Group[P, R]) SetTaskHandlerFunc(taskType TaskType, fn func(ctx context.Context, params P) (R, error)) {
+	g.pool.setTaskFn(taskType, func(ctx context.Context, params interface{}) (interface{}, error) {
+		p, _ := params.(P)
+		return fn(ctx, p)
+	})
+}
+
+func (g *Group[P, R]) SetTaskHandler(taskHandler TypedTaskHandlerI[P, R]) {
+	g.SetTaskHandlerFunc(taskHandler.GetTaskType(), taskHandler.GetTaskFn())
+}
+
+func (g *Group[P, R]) AddTask(taskType TaskType, label string, params P) (string, error) {
+	return g.pool.addTask(&task{taskType: taskType, label: label, params: params})
+}
+
+// AddTaskWithPriority 同 TaskPool.AddTaskWithPriority
+func (g *Group[P, R]) AddTaskWithPriority(taskType TaskType, label string, params P, priority int) (string, error) {
+	return g.pool.addTask(&task{taskType: taskType, label: label, params: params, priority: priority})
+}
+
+// AddTaskWithDeps 依赖的任务都成功后执行, buildParams 用依赖任务的结果生成参数
+func (g *Group[P, R]) AddTaskWithDeps(taskType TaskType, label string, buildParams func(depRetList map[string]R) P, depList ...string) (string, error) {
+	var params P
+	return g.pool.addTaskWithDeps(taskType, label, params, func(depRetList map[string]interface{}) interface{} {
+		retList := make(map[string]R, len(depRetList))
+		for dep, v := range depRetList {
+			r, _ := v.(R)
+			retList[dep] = r
+		}
+		return buildParams(retList)
+	}, depList)
+}
+
+func (g *Group[P, R]) Start() error {
+	return g.pool.Start()
+}
+
+// GroupResult 带类型的单个任务结果
+type GroupResult[R any] struct {
+	BatchID  string
+	ID       string
+	Label    string
+	TaskType TaskType
+	Ret      R
+	Err      error
+	Status   TaskStatus
+	Attempts int
+}
+
+func toGroupResult[R any](ret TaskResult) GroupResult[R] {
+	r, _ := ret.Ret.(R)
+	return GroupResult[R]{
+		BatchID:  ret.BatchID,
+		ID:       ret.ID,
+		Label:    ret.Label,
+		TaskType: ret.TaskType,
+		Ret:      r,
+		Err:      ret.Err,
+		Status:   ret.Status,
+		Attempts: ret.Attempts,
+	}
+}
+
+// StartStream 同 TaskPool.StartStream
+func (g *Group[P, R]) StartStream() (<-chan GroupResult[R], error) {
+	resultCh, err := g.pool.StartStream()
+	if err != nil {
+		return nil, err
+	}
+	groupCh := make(chan GroupResult[R], cap(resultCh))
+	go func() {
+		defer close(groupCh)
+		for ret := range resultCh {
+			groupCh <- toGroupResult[R](ret)
+		}
+	}()
+	return groupCh, nil
+}
+
+// StartWithCallback 同 TaskPool.StartWithCallback
+func (g *Group[P, R]) StartWithCallback(fn func(ret GroupResult[R])) error {
+	return g.pool.StartWithCallback(func(ret TaskResult) {
+		fn(toGroupResult[R](ret))
+	})
+}
+
+func (g *Group[P, R]) GetProgress() Progress {
+	return g.pool.GetProgress()
+}
+
+func (g *Group[P, R]) GetRetList() map[string]R {
+	poolRetList := g.pool.GetRetList()
+	retList := make(map[string]R, len(poolRetList))
+	for label, v := range poolRetList {
+		r, _ := v.(R)
+		retList[label] = r
+	}
+	return retList
+}
+
+// GetResultList 同 TaskPool.GetResultList
+func (g *Group[P, R]) GetResultList() []GroupResult[R] {
+	poolResultList := g.pool.GetResultList()
+	resultList := make([]GroupResult[R], 0, len(poolResultList))
+	for _, ret := range poolResultList {
+		resultList = append(resultList, toGroupResult[R](ret))
+	}
+	return resultList
+}
+
+func (g *Group[P, R]) GetErrList() map[string]error {
+	return g.pool.GetErrList()
+}
+
+func (g *Group[P, R]) GetStatusList() map[string]TaskStatus {
+	return g.pool.GetStatusList()
+}
+
+func (g *Group[P, R]) GetAttemptList() map[string]int {
+	return g.pool.GetAttemptList()
+}
+
+func (g *Group[P, R]) FirstErr() error {
+	return g.pool.FirstErr()
+}
+
+func (g *Group[P, R]) Clear(ctx context.Context) {
+	g.pool.Clear(ctx)
+}
+
+func (g *Group[P, R]) Release() {
+	g.pool.Release()
+}
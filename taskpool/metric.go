@@ -0,0 +1,87 @@
+package taskpool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+var (
+	TaskCounter *prometheus.CounterVec
+	TaskHistory *prometheus.HistogramVec
+)
+
+// GetMetricCollectors 任务指标以及协程池的使用情况
+// 协程池包括通过 RegisterWorkerPool 注册的, 默认共享的(taskpool-default)和任务池自己的(SetPoolName 设置的名字)
+func GetMetricCollectors(ns string) []prometheus.Collector {
+	subSystem := "taskpool"
+	TaskCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subSystem,
+			Name:      "task",
+			Help:      "task count by event: submit/succeeded/failed/cancelled/panic/reject",
+		},
+		[]string{"task_type", "event"},
+	)
+
+	TaskHistory = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: subSystem,
+			Name:      "task_seconds",
+			Help:      "the cost of task waiting in worker pool and running",
+		},
+		[]string{"task_type", "action"},
+	)
+
+	return []prometheus.Collector{
+		TaskCounter,
+		TaskHistory,
+		newWorkerPoolCollector(ns, subSystem),
+	}
+}
+
+func taskTypeLabel(taskType TaskType) string {
+	return strconv.Itoa(int(taskType))
+}
+
+// workerPoolCollector 采集时读取已注册的协程池和任务池自己的协程池
+type workerPoolCollector struct {
+	running  *prometheus.Desc
+	capacity *prometheus.Desc
+	free     *prometheus.Desc
+	waiting  *prometheus.Desc
+}
+
+func newWorkerPoolCollector(ns, subSystem string) *workerPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(ns, subSystem, name), help, []string{"pool"}, nil)
+	}
+	return &workerPoolCollector{
+		running:  desc("pool_running", "running workers of worker pool"),
+		capacity: desc("pool_capacity", "capacity of worker pool"),
+		free:     desc("pool_free", "free workers of worker pool"),
+		waiting:  desc("pool_waiting", "tasks waiting for worker"),
+	}
+}
+
+func (c *workerPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.running
+	ch <- c.capacity
+	ch <- c.free
+	ch <- c.waiting
+}
+
+func (c *workerPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	collect := func(key, value interface{}) bool {
+		name := key.(string)
+		pool := value.(*WorkerPool)
+		ch <- prometheus.MustNewConstMetric(c.running, prometheus.GaugeValue, float64(pool.Running()), name)
+		ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(pool.Cap()), name)
+		ch <- prometheus.MustNewConstMetric(c.free, prometheus.GaugeValue, float64(pool.Free()), name)
+		ch <- prometheus.MustNewConstMetric(c.waiting, prometheus.GaugeValue, float64(pool.Waiting()), name)
+		return true
+	}
+	workerPoolMap.Range(collect)
+	privatePoolMap.Range(collect)
+}
@@ -0,0 +1,75 @@
+package taskpool
+
+import (
+	"context"
+	"fmt"
+	"github.com/graymonster0927/component"
+	"runtime/debug"
+)
+
+// PanicError 任务 panic 时记录到 errList 的错误
+type PanicError struct {
+	Label    string
+	TaskType TaskType
+	//Value recover 得到的值
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("TaskPool Do Task Error: task %s panic: %v", e.Label, e.Value)
+}
+
+// Unwrap panic 的值是 error 时可以用 errors.Is/As 判断
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// SetPanicHandler 任务 panic 时回调, 在执行任务的协程中调用
+func (t *TaskPool) SetPanicHandler(handler func(ctx context.Context, err *PanicError)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.panicHandler = handler
+}
+
+// SetRePanic 任务 panic 后 Start 在调用方协程中重新 panic, 测试中用来暴露问题
+func (t *TaskPool) SetRePanic(rePanic bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.rePanic = rePanic
+}
+
+func (t *TaskPool) handlePanic(run *runState, task *task, r interface{}) *PanicError {
+	panicErr := t.reportPanic(run.ctx, task.label, task.taskType, r)
+	run.batch.lock.Lock()
+	if run.panicErr == nil {
+		run.panicErr = panicErr
+	}
+	run.batch.lock.Unlock()
+	t.recordErr(run, task, panicErr)
+	return panicErr
+}
+
+// reportPanic 在 recover 所在的 defer 中调用, 堆栈才包含 panic 的位置
+func (t *TaskPool) reportPanic(ctx context.Context, label string, taskType TaskType, r interface{}) *PanicError {
+	panicErr := &PanicError{
+		Label:    label,
+		TaskType: taskType,
+		Value:    r,
+		Stack:    debug.Stack(),
+	}
+	component.Logger.Errorf(ctx, "taskpool task %s panic: %v\n%s", label, r, panicErr.Stack)
+	if trace := t.getTrace(); trace != nil {
+		trace.TaskPanic(taskType, label, panicErr)
+	}
+	t.lock.RLock()
+	panicHandler := t.panicHandler
+	t.lock.RUnlock()
+	if panicHandler != nil {
+		panicHandler(ctx, panicErr)
+	}
+	return panicErr
+}
@@ -0,0 +1,239 @@
+package taskpool
+
+import (
+	"context"
+	"errors"
+	"github.com/graymonster0927/component"
+	uuid "github.com/satori/go.uuid"
+	"sync"
+	"time"
+)
+
+// queuePollInterval 队列为空时的轮询间隔
+const queuePollInterval = 100 * time.Millisecond
+
+// queueDefaultConcurrency 协程池不限容量且没有设置并发数时, 同时取出的任务数
+const queueDefaultConcurrency = 100
+
+// ErrQueueEmpty 队列中没有可以投递的任务
+var ErrQueueEmpty = errors.New("queue empty")
+
+// QueueMessage 持久化队列中的任务, Params 按 json 保存, 数字取出后为 float64
+type QueueMessage struct {
+	ID       string                 `json:"id"`
+	TaskType TaskType               `json:"task_type"`
+	Label    string                 `json:"label"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	//Attempts 已投递的次数
+	Attempts int `json:"attempts"`
+	//raw 队列中的原始值, Ack/Nack 时使用
+	raw string
+}
+
+func NewQueueMessage(taskType TaskType, label string, params map[string]interface{}) *QueueMessage {
+	return &QueueMessage{
+		ID:       uuid.NewV4().String(),
+		TaskType: taskType,
+		Label:    label,
+		Params:   params,
+	}
+}
+
+// Queue 持久化的任务队列, 至少投递一次
+// Pop 后在可见性超时内没有 Ack 的任务重新投递, 投递次数超过上限后进入死信
+type Queue interface {
+	Push(ctx context.Context, msg *QueueMessage) error
+	// Pop 没有任务时返回 ErrQueueEmpty
+	Pop(ctx context.Context) (*QueueMessage, error)
+	Ack(ctx context.Context, msg *QueueMessage) error
+	// Nack 执行失败, 重新投递, 已达到投递上限时进入死信
+	Nack(ctx context.Context, msg *QueueMessage) error
+	// PopDeadLetter 取出一个死信任务, 没有时返回 ErrQueueEmpty
+	PopDeadLetter(ctx context.Context) (*QueueMessage, error)
+}
+
+type QueueOption func(*queueOptions)
+
+type queueOptions struct {
+	visibilityTimeout time.Duration
+	maxAttempts       int
+	sync              bool
+	compactThreshold  int
+}
+
+func defaultQueueOptions() queueOptions {
+	return queueOptions{
+		visibilityTimeout: 30 * time.Second,
+		maxAttempts:       3,
+		sync:              true,
+		compactThreshold:  10000,
+	}
+}
+
+// WithQueueVisibilityTimeout 投递后超过这个时间没有 Ack 则重新投递, 要大于任务的执行时间
+func WithQueueVisibilityTimeout(visibilityTimeout time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.visibilityTimeout = visibilityTimeout
+	}
+}
+
+// WithQueueMaxAttempts 最多投递次数, 超过后进入死信
+func WithQueueMaxAttempts(maxAttempts int) QueueOption {
+	return func(o *queueOptions) {
+		o.maxAttempts = maxAttempts
+	}
+}
+
+// WithQueueSync 文件队列每次写入后 fsync, 关闭后进程崩溃不丢但机器掉电可能丢最近的写入
+func WithQueueSync(sync bool) QueueOption {
+	return func(o *queueOptions) {
+		o.sync = sync
+	}
+}
+
+// WithQueueCompactThreshold 文件队列的记录数超过这个值且大于有效任务数的两倍时压缩文件
+func WithQueueCompactThreshold(compactThreshold int) QueueOption {
+	return func(o *queueOptions) {
+		o.compactThreshold = compactThreshold
+	}
+}
+
+// SetQueue 设置持久化队列, 通过 PushTask 写入, ConsumeQueue 消费
+func (t *TaskPool) SetQueue(queue Queue) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.queue = queue
+}
+
+func (t *TaskPool) getQueue() Queue {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.queue
+}
+
+// PushTask 写入持久化队列, 进程崩溃后不丢失
+func (t *TaskPool) PushTask(ctx context.Context, taskType TaskType, label string, params map[string]interface{}) error {
+	queue := t.getQueue()
+	if queue == nil {
+		return errors.New("当前没有配置任务队列")
+	}
+	return queue.Push(ctx, NewQueueMessage(taskType, label, params))
+}
+
+// ConsumeQueue 持续消费持久化队列, 成功 Ack, 失败 Nack 等待重新投递
+// 同样使用协程池, 并发数, 限速, 超时, 重试和 panic 处理的配置, 结果不记录到 GetRetList
+// ctx 取消后不再取任务, 等执行中的任务结束后返回
+func (t *TaskPool) ConsumeQueue(ctx context.Context) error {
+	queue := t.getQueue()
+	if queue == nil {
+		return errors.New("当前没有配置任务队列")
+	}
+	pool, err := t.getWorkerPool()
+	if err != nil {
+		return err
+	}
+
+	//取出的任务不超过能同时执行的数量 避免在本地排队时可见性超时
+	concurrency := pool.Cap()
+	t.lock.RLock()
+	if t.sem != nil {
+		concurrency = cap(t.sem)
+	}
+	t.lock.RUnlock()
+	if concurrency <= 0 {
+		//协程池不限容量时按默认数量取出
+		concurrency = queueDefaultConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		msg, err := queue.Pop(ctx)
+		if err != nil {
+			<-slots
+			if !errors.Is(err, ErrQueueEmpty) && ctx.Err() == nil {
+				component.Logger.Errorf(ctx, "taskpool queue pop failed: %v", err)
+			}
+			select {
+			case <-time.After(queuePollInterval):
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+
+		if trace := t.getTrace(); trace != nil {
+			trace.TaskSubmit(msg.TaskType, msg.Label)
+		}
+		popAt := time.Now()
+		wg.Add(1)
+		fn := func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			t.consume(ctx, queue, msg, popAt)
+		}
+		//协程池满了等有任务结束后再提交, 不直接 Nack, 避免没执行的任务用掉投递次数进入死信
+		if err := pool.submitWait(ctx, fn); err != nil {
+			t.traceReject(msg.TaskType, msg.Label, err)
+			<-slots
+			wg.Done()
+			t.nack(ctx, queue, msg)
+		}
+	}
+}
+
+func (t *TaskPool) consume(ctx context.Context, queue Queue, msg *QueueMessage, popAt time.Time) {
+	startAt := time.Now()
+	if trace := t.getTrace(); trace != nil {
+		trace.TaskStart(msg.TaskType, msg.Label, startAt.Sub(popAt))
+	}
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = t.reportPanic(ctx, msg.Label, msg.TaskType, r)
+		}
+		if trace := t.getTrace(); trace != nil {
+			status := TaskStatusSucceeded
+			if err != nil {
+				status = TaskStatusFailed
+			}
+			trace.TaskFinish(msg.TaskType, msg.Label, status, time.Since(startAt), err)
+		}
+		if err != nil {
+			t.nack(ctx, queue, msg)
+		}
+	}()
+
+	if _, ok := t.getTaskFn(msg.TaskType); !ok {
+		component.Logger.Errorf(ctx, "taskpool queue task %s type %d has no handler", msg.Label, msg.TaskType)
+		err = errors.New("当前任务类型没有配置处理函数")
+		return
+	}
+	if limiter, ok := t.getLimiter(msg.TaskType); ok {
+		if err = limiter.Wait(ctx); err != nil {
+			return
+		}
+	}
+	if _, _, err = t.execute(ctx, msg.TaskType, msg.Params); err != nil {
+		return
+	}
+	//停止消费时也要确认已完成的任务
+	if err := queue.Ack(context.WithoutCancel(ctx), msg); err != nil {
+		component.Logger.Errorf(ctx, "taskpool queue ack %s failed: %v", msg.ID, err)
+	}
+}
+
+func (t *TaskPool) nack(ctx context.Context, queue Queue, msg *QueueMessage) {
+	if err := queue.Nack(context.WithoutCancel(ctx), msg); err != nil {
+		component.Logger.Errorf(ctx, "taskpool queue nack %s failed: %v", msg.ID, err)
+	}
+}
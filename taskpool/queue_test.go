@@ -0,0 +1,193 @@
+package taskpool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileQueue(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.log")
+	queue, err := NewFileQueue(path, WithQueueVisibilityTimeout(20*time.Millisecond), WithQueueMaxAttempts(2))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_ = queue.Push(ctx, NewQueueMessage(taskTypeTestEcho, "a", map[string]interface{}{"v": 1}))
+	_ = queue.Push(ctx, NewQueueMessage(taskTypeTestEcho, "b", nil))
+
+	msg, err := queue.Pop(ctx)
+	if err != nil || msg.Label != "a" || msg.Attempts != 1 || msg.Params["v"] != 1 {
+		t.Fatalf("Expected a on 1st attempt, got %+v %v", msg, err)
+	}
+	if err := queue.Ack(ctx, msg); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	//不 Ack 时可见性超时后重新投递, 超过投递次数进入死信
+	msg, _ = queue.Pop(ctx)
+	if msg.Label != "b" {
+		t.Fatalf("Expected b, got %+v", msg)
+	}
+	if _, err := queue.Pop(ctx); !errors.Is(err, ErrQueueEmpty) {
+		t.Errorf("Expected b invisible, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	msg, _ = queue.Pop(ctx)
+	if msg == nil || msg.Label != "b" || msg.Attempts != 2 {
+		t.Fatalf("Expected b redelivered, got %+v", msg)
+	}
+	_ = queue.Nack(ctx, msg)
+	if _, err := queue.Pop(ctx); !errors.Is(err, ErrQueueEmpty) {
+		t.Errorf("Expected b dead lettered, got %v", err)
+	}
+
+	//重新打开后从日志恢复
+	_ = queue.Push(ctx, NewQueueMessage(taskTypeTestEcho, "c", nil))
+	msg, _ = queue.Pop(ctx)
+	_ = queue.Close()
+	//模拟写入一半时崩溃
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.WriteString(`{"op":"push","msg":{"id":"x"`)
+	_ = file.Close()
+
+	queue, err = NewFileQueue(path, WithQueueVisibilityTimeout(time.Millisecond), WithQueueMaxAttempts(2))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer queue.Close()
+	dead, err := queue.PopDeadLetter(ctx)
+	if err != nil || dead.Label != "b" {
+		t.Errorf("Expected b in dead letter, got %+v %v", dead, err)
+	}
+	//可见性截止时间同样从日志恢复
+	time.Sleep(30 * time.Millisecond)
+	redelivered, err := queue.Pop(ctx)
+	if err != nil || redelivered.ID != msg.ID || redelivered.Attempts != 2 {
+		t.Errorf("Expected unacked c redelivered after restart, got %+v %v", redelivered, err)
+	}
+	if queue.Len() != 1 {
+		t.Errorf("Expected 1 task left, got %d", queue.Len())
+	}
+}
+
+func TestTaskPool_ConsumeQueue(t *testing.T) {
+	queue, err := NewFileQueue(filepath.Join(t.TempDir(), "queue.log"), WithQueueMaxAttempts(2), WithQueueSync(false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer queue.Close()
+
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetQueue(queue)
+	var echo, fail atomic.Int32
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		echo.Add(1)
+		return params["v"], nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		fail.Add(1)
+		return nil, errors.New("test error")
+	})
+	for i := 0; i < 5; i++ {
+		_ = taskPool.PushTask(context.Background(), taskTypeTestEcho, "echo", map[string]interface{}{"v": i})
+	}
+	_ = taskPool.PushTask(context.Background(), taskTypeTestErr, "err", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- taskPool.ConsumeQueue(ctx)
+	}()
+	for i := 0; i < 100 && queue.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if echo.Load() != 5 || fail.Load() != 2 {
+		t.Errorf("Expected 5 echo and 2 attempts of err, got %d %d", echo.Load(), fail.Load())
+	}
+	dead, err := queue.PopDeadLetter(context.Background())
+	if err != nil || dead.Label != "err" {
+		t.Errorf("Expected err in dead letter, got %+v %v", dead, err)
+	}
+}
+
+func TestTaskPool_ConsumeQueue_Unlimited(t *testing.T) {
+	queue, err := NewFileQueue(filepath.Join(t.TempDir(), "queue.log"), WithQueueSync(false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer queue.Close()
+	pool, err := NewWorkerPool(-1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetWorkerPool(pool)
+	taskPool.SetQueue(queue)
+	var echo atomic.Int32
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		echo.Add(1)
+		return nil, nil
+	})
+	for i := 0; i < 5; i++ {
+		_ = taskPool.PushTask(context.Background(), taskTypeTestEcho, "echo", nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- taskPool.ConsumeQueue(ctx)
+	}()
+	for i := 0; i < 100 && echo.Load() < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if echo.Load() != 5 {
+		t.Errorf("Expected 5 echo with unlimited pool, got %d", echo.Load())
+	}
+}
+
+func TestFileQueue_Compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.log")
+	queue, err := NewFileQueue(path, WithQueueCompactThreshold(10), WithQueueSync(false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		_ = queue.Push(ctx, NewQueueMessage(taskTypeTestEcho, "a", nil))
+		msg, _ := queue.Pop(ctx)
+		_ = queue.Ack(ctx, msg)
+	}
+	_ = queue.Push(ctx, NewQueueMessage(taskTypeTestEcho, "left", nil))
+	_ = queue.Close()
+
+	queue, err = NewFileQueue(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer queue.Close()
+	if queue.recordCount >= 10 || queue.Len() != 1 {
+		t.Errorf("Expected log compacted with 1 task left, got %d records %d tasks", queue.recordCount, queue.Len())
+	}
+	if msg, err := queue.Pop(ctx); err != nil || msg.Label != "left" {
+		t.Errorf("Expected left, got %+v %v", msg, err)
+	}
+}
@@ -0,0 +1,169 @@
+package taskpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/graymonster0927/component"
+	"strings"
+	"time"
+)
+
+// redisPopScript 超时的任务放回队列后取出一个, 投递次数超过上限的放入死信
+// KEYS[1] 队列 KEYS[2] 执行中(zset, score 为可见性截止毫秒) KEYS[3] 死信 KEYS[4] 投递次数(hash)
+// ARGV[1] 当前毫秒 ARGV[2] 可见性截止毫秒 ARGV[3] 最大投递次数
+const redisPopScript = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, v in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], v)
+	redis.call('LPUSH', KEYS[1], v)
+end
+while true do
+	local v = redis.call('RPOP', KEYS[1])
+	if not v then
+		return false
+	end
+	local attempts = redis.call('HINCRBY', KEYS[4], v, 1)
+	if attempts > tonumber(ARGV[3]) then
+		redis.call('HDEL', KEYS[4], v)
+		redis.call('LPUSH', KEYS[3], v)
+	else
+		redis.call('ZADD', KEYS[2], ARGV[2], v)
+		return {v, attempts}
+	end
+end
+`
+
+// redisAckScript KEYS 同 redisPopScript, ARGV[1] 任务
+const redisAckScript = `
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+return 1
+`
+
+// redisNackScript 还在执行中时放回队列, ARGV[2] 为 1 时放入死信
+const redisNackScript = `
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+if ARGV[2] == '1' then
+	redis.call('HDEL', KEYS[4], ARGV[1])
+	redis.call('LPUSH', KEYS[3], ARGV[1])
+else
+	redis.call('LPUSH', KEYS[1], ARGV[1])
+end
+return 1
+`
+
+// RedisQueue 基于 Redis list 的持久化队列, 多个进程可以同时消费
+// 投递次数记录在 hash 中, 任务的原始值不变
+// key 没有 hash tag 时整个 key 作为 hash tag, 脚本操作的几个 key 在 cluster 的同一个 slot
+type RedisQueue struct {
+	conn component.RedisInterface
+	key  string
+	opts queueOptions
+}
+
+func NewRedisQueue(conn component.RedisInterface, key string, opts ...QueueOption) *RedisQueue {
+	op := defaultQueueOptions()
+	for _, option := range opts {
+		option(&op)
+	}
+	return &RedisQueue{
+		conn: conn,
+		key:  redisHashTag(key),
+		opts: op,
+	}
+}
+
+func (q *RedisQueue) keyList() []string {
+	return []string{q.key, q.key + ":inflight", q.key + ":dead", q.key + ":attempts"}
+}
+
+func (q *RedisQueue) Push(ctx context.Context, msg *QueueMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = q.conn.LPush(ctx, q.key, string(data)).Result()
+	return err
+}
+
+func (q *RedisQueue) Pop(ctx context.Context) (*QueueMessage, error) {
+	now := time.Now()
+	reply, err := q.conn.Eval(ctx, redisPopScript, q.keyList(),
+		now.UnixMilli(), now.Add(q.opts.visibilityTimeout).UnixMilli(), q.opts.maxAttempts)
+	if err == redis.Nil || (err == nil && reply == nil) {
+		return nil, ErrQueueEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	replyList, ok := reply.([]interface{})
+	if !ok || len(replyList) != 2 {
+		return nil, errors.New(fmt.Sprintf("redis queue pop reply %v not support", reply))
+	}
+	raw, ok := replyList[0].(string)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("redis queue pop reply %v not support", reply))
+	}
+	attempts, _ := replyList[1].(int64)
+
+	msg, err := q.decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	msg.Attempts = int(attempts)
+	return msg, nil
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, msg *QueueMessage) error {
+	_, err := q.conn.Eval(ctx, redisAckScript, q.keyList(), msg.raw)
+	return err
+}
+
+func (q *RedisQueue) Nack(ctx context.Context, msg *QueueMessage) error {
+	dead := 0
+	if msg.Attempts >= q.opts.maxAttempts {
+		dead = 1
+	}
+	_, err := q.conn.Eval(ctx, redisNackScript, q.keyList(), msg.raw, dead)
+	return err
+}
+
+// PopDeadLetter 死信任务的 Attempts 为 0
+func (q *RedisQueue) PopDeadLetter(ctx context.Context) (*QueueMessage, error) {
+	raw, err := q.conn.RPop(ctx, q.key+":dead").Result()
+	if err == redis.Nil || (err == nil && raw == "") {
+		return nil, ErrQueueEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q.decode(raw)
+}
+
+// redisHashTag key 已有 hash tag 时原样返回, 否则整个 key 作为 hash tag
+func redisHashTag(key string) string {
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key
+		}
+	}
+	if strings.Contains(key, "}") {
+		//无法加 hash tag, 非 cluster 下不受影响
+		return key
+	}
+	return "{" + key + "}"
+}
+
+func (q *RedisQueue) decode(raw string) (*QueueMessage, error) {
+	msg := &QueueMessage{}
+	if err := json.Unmarshal([]byte(raw), msg); err != nil {
+		return nil, err
+	}
+	msg.raw = raw
+	return msg, nil
+}
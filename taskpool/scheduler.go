@@ -0,0 +1,391 @@
+package taskpool
+
+import (
+	"context"
+	"errors"
+	"github.com/graymonster0927/component"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Schedule 计算下一次执行的时间, 返回零值表示不再执行
+type Schedule interface {
+	Next(prev time.Time) time.Time
+}
+
+// fixedRateSchedule 按固定频率执行, 不受执行耗时影响
+type fixedRateSchedule struct {
+	interval time.Duration
+}
+
+func (f fixedRateSchedule) Next(prev time.Time) time.Time {
+	return prev.Add(f.interval)
+}
+
+// OverlapPolicy 上一次还没执行完又到了执行时间时的处理方式
+type OverlapPolicy int
+
+const (
+	// OverlapSkip 跳过这一次
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue 等上一次执行完后再执行
+	OverlapQueue
+	// OverlapConcurrent 同时执行
+	OverlapConcurrent
+)
+
+type JobOption func(*jobOptions)
+
+type jobOptions struct {
+	jitter  time.Duration
+	overlap OverlapPolicy
+	timeout time.Duration
+}
+
+// WithJobJitter 每次执行时间随机延后 [0, jitter), 避免多个实例同时执行
+func WithJobJitter(jitter time.Duration) JobOption {
+	return func(o *jobOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithJobOverlap 默认 OverlapSkip, 固定间隔(AddFixedDelay)的任务不会重叠
+func WithJobOverlap(overlap OverlapPolicy) JobOption {
+	return func(o *jobOptions) {
+		o.overlap = overlap
+	}
+}
+
+// WithJobTimeout 单次执行的超时
+func WithJobTimeout(timeout time.Duration) JobOption {
+	return func(o *jobOptions) {
+		o.timeout = timeout
+	}
+}
+
+type SchedulerOption func(*schedulerOptions)
+
+type schedulerOptions struct {
+	pool *WorkerPool
+}
+
+// WithSchedulerWorkerPool 在共享的协程池中执行, 默认创建自己的协程池
+func WithSchedulerWorkerPool(pool *WorkerPool) SchedulerOption {
+	return func(o *schedulerOptions) {
+		o.pool = pool
+	}
+}
+
+type job struct {
+	name     string
+	fn       func(ctx context.Context) error
+	schedule Schedule
+	//delay 大于 0 时为固定间隔, 上一次执行完后等待 delay 再执行
+	delay  time.Duration
+	opts   jobOptions
+	stopCh chan struct{}
+	//finishCh 有排队的执行时, 执行结束后通知调度协程提交下一次
+	finishCh chan struct{}
+	lock     sync.Mutex
+	running  int
+	pending  int
+}
+
+// Scheduler 定时任务, 支持 cron, 固定频率和固定间隔, 在协程池中执行
+type Scheduler struct {
+	pool    *WorkerPool
+	ownPool bool
+	lock    sync.Mutex
+	jobMap  map[string]*job
+	started bool
+	stopped bool
+	//loopWg 调度协程, runWg 执行中的任务
+	loopWg sync.WaitGroup
+	runWg  sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewScheduler(opts ...SchedulerOption) (*Scheduler, error) {
+	op := schedulerOptions{}
+	for _, option := range opts {
+		option(&op)
+	}
+	s := &Scheduler{
+		pool:   op.pool,
+		jobMap: make(map[string]*job),
+	}
+	if s.pool == nil {
+		pool, err := NewWorkerPool(100, WithNonblocking(false))
+		if err != nil {
+			return nil, err
+		}
+		s.pool = pool
+		s.ownPool = true
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// AddCron 按 cron 表达式执行, 表达式格式见 ParseCron
+func (s *Scheduler) AddCron(name string, spec string, fn func(ctx context.Context) error, opts ...JobOption) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	return s.AddSchedule(name, schedule, fn, opts...)
+}
+
+// AddFixedRate 每隔 interval 执行一次, 执行耗时超过 interval 时按 OverlapPolicy 处理
+func (s *Scheduler) AddFixedRate(name string, interval time.Duration, fn func(ctx context.Context) error, opts ...JobOption) error {
+	if interval <= 0 {
+		return errors.New("interval 必须大于 0")
+	}
+	return s.AddSchedule(name, fixedRateSchedule{interval: interval}, fn, opts...)
+}
+
+// AddFixedDelay 上一次执行完后等待 delay 再执行
+func (s *Scheduler) AddFixedDelay(name string, delay time.Duration, fn func(ctx context.Context) error, opts ...JobOption) error {
+	if delay <= 0 {
+		return errors.New("delay 必须大于 0")
+	}
+	return s.addJob(&job{name: name, fn: fn, delay: delay}, opts)
+}
+
+// AddSchedule 自定义执行时间
+func (s *Scheduler) AddSchedule(name string, schedule Schedule, fn func(ctx context.Context) error, opts ...JobOption) error {
+	return s.addJob(&job{name: name, fn: fn, schedule: schedule}, opts)
+}
+
+func (s *Scheduler) addJob(j *job, opts []JobOption) error {
+	for _, option := range opts {
+		option(&j.opts)
+	}
+	j.stopCh = make(chan struct{})
+	j.finishCh = make(chan struct{}, 1)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return errors.New("scheduler stopped")
+	}
+	if _, ok := s.jobMap[j.name]; ok {
+		return errors.New("job " + j.name + " already exists")
+	}
+	s.jobMap[j.name] = j
+	if s.started {
+		s.loopWg.Add(1)
+		go s.loop(j)
+	}
+	return nil
+}
+
+// Remove 停止调度, 不影响执行中的任务
+func (s *Scheduler) Remove(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobMap[name]; ok {
+		close(j.stopCh)
+		delete(s.jobMap, name)
+	}
+}
+
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobMap {
+		s.loopWg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// Stop 停止调度并等待执行中的任务结束, ctx 超时后取消执行中任务的 ctx 并返回 ctx.Err()
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return nil
+	}
+	s.stopped = true
+	for _, j := range s.jobMap {
+		close(j.stopCh)
+	}
+	s.jobMap = make(map[string]*job)
+	s.lock.Unlock()
+	s.loopWg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runWg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.cancel()
+	if s.ownPool {
+		s.pool.Release()
+	}
+	return err
+}
+
+func (s *Scheduler) loop(j *job) {
+	defer s.loopWg.Done()
+
+	now := time.Now()
+	next := now.Add(j.delay)
+	if j.schedule != nil {
+		next = j.schedule.Next(now)
+	}
+	for !next.IsZero() {
+		if !s.wait(j, time.Until(next)+s.jitter(j)) {
+			return
+		}
+
+		if j.schedule == nil {
+			//固定间隔 等这一次执行完
+			done := make(chan struct{})
+			s.start(j, func() { close(done) })
+			select {
+			case <-done:
+			case <-j.stopCh:
+				return
+			}
+			next = time.Now().Add(j.delay)
+			continue
+		}
+
+		s.fire(j)
+		//错过的执行时间不补
+		now := time.Now()
+		for !next.IsZero() && !next.After(now) {
+			next = j.schedule.Next(next)
+		}
+	}
+}
+
+// wait 等待过程中提交排队的执行, 停止调度时返回 false
+func (s *Scheduler) wait(j *job, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-j.stopCh:
+			return false
+		case <-j.finishCh:
+			s.startPending(j)
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// jitter math/rand 的全局函数启动时随机初始化, 每个进程的序列不同
+func (s *Scheduler) jitter(j *job) time.Duration {
+	if j.opts.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(j.opts.jitter)))
+}
+
+func (s *Scheduler) fire(j *job) {
+	j.lock.Lock()
+	if j.running > 0 {
+		switch j.opts.overlap {
+		case OverlapSkip:
+			j.lock.Unlock()
+			component.Logger.Warnf(s.ctx, "scheduler job %s still running, skip", j.name)
+			return
+		case OverlapQueue:
+			j.pending++
+			j.lock.Unlock()
+			return
+		}
+	}
+	j.lock.Unlock()
+	s.start(j, nil)
+}
+
+// start 提交到协程池
+func (s *Scheduler) start(j *job, onDone func()) {
+	j.lock.Lock()
+	j.running++
+	j.lock.Unlock()
+	s.submit(j, onDone)
+}
+
+// submit 调用方已经增加了 running
+func (s *Scheduler) submit(j *job, onDone func()) {
+	s.runWg.Add(1)
+	err := s.pool.Submit(func() {
+		defer s.finish(j, onDone)
+		s.run(j)
+	})
+	if err != nil {
+		component.Logger.Errorf(s.ctx, "scheduler job %s submit failed: %v", j.name, err)
+		j.lock.Lock()
+		j.running--
+		j.lock.Unlock()
+		s.runWg.Done()
+		if onDone != nil {
+			onDone()
+		}
+	}
+}
+
+// finish 有排队的执行时通知调度协程, 不在协程池中提交, 避免协程池满时阻塞在自己的协程里
+func (s *Scheduler) finish(j *job, onDone func()) {
+	if onDone != nil {
+		onDone()
+	}
+	j.lock.Lock()
+	j.running--
+	pending := j.pending > 0
+	j.lock.Unlock()
+	if pending {
+		select {
+		case j.finishCh <- struct{}{}:
+		default:
+		}
+	}
+	s.runWg.Done()
+}
+
+// startPending 在调度协程中执行排队的, 停止调度后不再执行
+func (s *Scheduler) startPending(j *job) {
+	j.lock.Lock()
+	if j.pending == 0 || j.running > 0 {
+		j.lock.Unlock()
+		return
+	}
+	j.pending--
+	j.running++
+	j.lock.Unlock()
+	s.submit(j, nil)
+}
+
+func (s *Scheduler) run(j *job) {
+	defer func() {
+		if r := recover(); r != nil {
+			component.Logger.Errorf(s.ctx, "scheduler job %s panic: %v\n%s", j.name, r, debug.Stack())
+		}
+	}()
+	ctx := s.ctx
+	if j.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.timeout)
+		defer cancel()
+	}
+	if err := j.fn(ctx); err != nil {
+		component.Logger.Errorf(ctx, "scheduler job %s failed: %v", j.name, err)
+	}
+}
@@ -0,0 +1,161 @@
+package taskpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+	testList := []struct {
+		spec string
+		from time.Time
+		next time.Time
+	}{
+		{"*/15 * * * *", date(2024, 1, 1, 10, 7, 30), date(2024, 1, 1, 10, 15, 0)},
+		{"0 9 * * mon-fri", date(2024, 1, 6, 10, 0, 0), date(2024, 1, 8, 9, 0, 0)},
+		{"30 0 0 1 jan *", date(2024, 3, 1, 0, 0, 0), date(2025, 1, 1, 0, 0, 30)},
+		{"@daily", date(2024, 2, 28, 12, 0, 0), date(2024, 2, 29, 0, 0, 0)},
+		{"0 0 31 * *", date(2024, 4, 1, 0, 0, 0), date(2024, 5, 31, 0, 0, 0)},
+		//日和星期都有限制时满足其一
+		{"0 0 13 * 5", date(2024, 1, 1, 0, 0, 0), date(2024, 1, 5, 0, 0, 0)},
+		{"0 0 * * 7", date(2024, 1, 1, 0, 0, 0), date(2024, 1, 7, 0, 0, 0)},
+		{"5,10-12/2 * * * *", date(2024, 1, 1, 0, 5, 0), date(2024, 1, 1, 0, 10, 0)},
+	}
+	for _, tt := range testList {
+		schedule, err := ParseCronInLocation(tt.spec, time.UTC)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %v", tt.spec, err)
+			continue
+		}
+		if next := schedule.Next(tt.from); !next.Equal(tt.next) {
+			t.Errorf("Expected %q next %v, got %v", tt.spec, tt.next, next)
+		}
+	}
+
+	for _, spec := range []string{"61 * * * *", "* * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	scheduler, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	countMap := make(map[OverlapPolicy]*atomic.Int32)
+	maxRunningMap := make(map[OverlapPolicy]*atomic.Int32)
+	for _, overlap := range []OverlapPolicy{OverlapSkip, OverlapQueue, OverlapConcurrent} {
+		var count, running, maxRunning atomic.Int32
+		countMap[overlap] = &count
+		maxRunningMap[overlap] = &maxRunning
+		err := scheduler.AddFixedRate(string(rune('a'+overlap)), 10*time.Millisecond, func(ctx context.Context) error {
+			count.Add(1)
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			defer running.Add(-1)
+			time.Sleep(35 * time.Millisecond)
+			return nil
+		}, WithJobOverlap(overlap))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	scheduler.Start()
+	time.Sleep(120 * time.Millisecond)
+	if err := scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if maxRunningMap[OverlapSkip].Load() != 1 || maxRunningMap[OverlapQueue].Load() != 1 {
+		t.Errorf("Expected skip and queue run one at a time, got %d %d", maxRunningMap[OverlapSkip].Load(), maxRunningMap[OverlapQueue].Load())
+	}
+	if maxRunningMap[OverlapConcurrent].Load() < 2 {
+		t.Errorf("Expected concurrent runs, got %d", maxRunningMap[OverlapConcurrent].Load())
+	}
+	if countMap[OverlapSkip].Load() >= countMap[OverlapConcurrent].Load() {
+		t.Errorf("Expected skip run less than concurrent, got %d %d", countMap[OverlapSkip].Load(), countMap[OverlapConcurrent].Load())
+	}
+}
+
+func TestScheduler_OverlapQueueFullPool(t *testing.T) {
+	pool, err := NewWorkerPool(1, WithNonblocking(false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+	scheduler, err := NewScheduler(WithSchedulerWorkerPool(pool))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	//协程池只有一个协程, 排队的执行不能在任务自己的协程里提交
+	var count atomic.Int32
+	err = scheduler.AddFixedRate("a", 5*time.Millisecond, func(ctx context.Context) error {
+		count.Add(1)
+		time.Sleep(15 * time.Millisecond)
+		return nil
+	}, WithJobOverlap(OverlapQueue))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	scheduler.Start()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count.Load() < 3 {
+		t.Errorf("Expected queued runs executed, got %d", count.Load())
+	}
+}
+
+func TestScheduler_FixedDelayAndStop(t *testing.T) {
+	scheduler, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lock := sync.Mutex{}
+	startList := make([]time.Time, 0)
+	var finished atomic.Bool
+	err = scheduler.AddFixedDelay("delay", 10*time.Millisecond, func(ctx context.Context) error {
+		lock.Lock()
+		startList = append(startList, time.Now())
+		lock.Unlock()
+		finished.Store(false)
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	scheduler.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	//Stop 等执行中的任务结束
+	if err := scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !finished.Load() {
+		t.Errorf("Expected in-flight run finished before Stop returned")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(startList) < 2 {
+		t.Fatalf("Expected at least 2 runs, got %d", len(startList))
+	}
+	for i := 1; i < len(startList); i++ {
+		if gap := startList[i].Sub(startList[i-1]); gap < 30*time.Millisecond {
+			t.Errorf("Expected gap >= run time + delay, got %v", gap)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package taskpool
+
+// TaskStatus 任务执行结束后的状态
+type TaskStatus int
+
+const (
+	// TaskStatusPending 还没有执行
+	TaskStatusPending TaskStatus = iota
+	// TaskStatusSucceeded 执行成功
+	TaskStatusSucceeded
+	// TaskStatusFailed 执行失败, 包括 panic, 单个任务超时和提交失败
+	TaskStatusFailed
+	// TaskStatusCancelled ctx 取消, 整批超时或快速失败后没有执行或被中断
+	TaskStatusCancelled
+	// TaskStatusSkipped 依赖的任务没有成功, 没有执行
+	TaskStatusSkipped
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskStatusPending:
+		return "pending"
+	case TaskStatusSucceeded:
+		return "succeeded"
+	case TaskStatusFailed:
+		return "failed"
+	case TaskStatusCancelled:
+		return "cancelled"
+	case TaskStatusSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
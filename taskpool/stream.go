@@ -0,0 +1,83 @@
+package taskpool
+
+// TaskResult 单个任务的结果, 流式返回时使用
+type TaskResult struct {
+	//BatchID 所属批次, 见 GetBatch
+	BatchID string
+	//ID AddTask 返回的任务 ID
+	ID       string
+	Label    string
+	TaskType TaskType
+	Ret      interface{}
+	Err      error
+	Status   TaskStatus
+	//Attempts 执行的次数, 包括重试
+	Attempts int
+}
+
+// Progress 执行进度
+type Progress struct {
+	Total     int
+	Done      int
+	Succeeded int
+	Failed    int
+	Cancelled int
+	Skipped   int
+}
+
+// Pending 还没结束的任务数
+func (p Progress) Pending() int {
+	return p.Total - p.Done
+}
+
+func (p *Progress) add(status TaskStatus) {
+	p.Done++
+	switch status {
+	case TaskStatusSucceeded:
+		p.Succeeded++
+	case TaskStatusFailed:
+		p.Failed++
+	case TaskStatusCancelled:
+		p.Cancelled++
+	case TaskStatusSkipped:
+		p.Skipped++
+	}
+}
+
+// StartStream 异步执行, 每个任务结束后立即通过 channel 返回结果, 全部结束后关闭 channel
+// 执行中也可以读取 GetRetList/GetErrList, 返回已结束任务结果的副本
+func (t *TaskPool) StartStream() (<-chan TaskResult, error) {
+	run, err := t.prepare()
+	if err != nil {
+		return nil, err
+	}
+	run.resultCh = make(chan TaskResult, len(run.taskList))
+	go func() {
+		defer close(run.resultCh)
+		t.run(run)
+	}()
+	return run.resultCh, nil
+}
+
+// StartWithCallback 每个任务结束后在调用方协程中依次回调, 全部结束后返回
+func (t *TaskPool) StartWithCallback(fn func(ret TaskResult)) error {
+	run, err := t.prepare()
+	if err != nil {
+		return err
+	}
+	run.resultCh = make(chan TaskResult, len(run.taskList))
+	go func() {
+		defer close(run.resultCh)
+		t.run(run)
+	}()
+	for ret := range run.resultCh {
+		fn(ret)
+	}
+	t.checkRePanic(run)
+	return nil
+}
+
+// GetProgress 最近一次 Start 的进度, 执行中也可以调用
+func (t *TaskPool) GetProgress() Progress {
+	return t.LastBatch().GetProgress()
+}
@@ -8,3 +8,9 @@ type TaskHandlerI interface {
 	GetTaskFn() func(ctx context.Context, params map[string]interface{}) (interface{}, error)
 	GetTaskType() TaskType
 }
+
+// TypedTaskHandlerI Group 使用的带类型的任务处理器
+type TypedTaskHandlerI[P any, R any] interface {
+	GetTaskFn() func(ctx context.Context, params P) (R, error)
+	GetTaskType() TaskType
+}
@@ -4,157 +4,748 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/graymonster0927/component/retry"
+	uuid "github.com/satori/go.uuid"
+	"sort"
 	"sync"
 	"time"
 )
 
-var gPool *ants.Pool
-var gPoolSize = 5000
-var once = sync.Once{}
-
-func getGPoolInstance() (*ants.Pool, error) {
-	var err error
-	once.Do(func() {
-		gPool, err = ants.NewPool(gPoolSize, ants.WithNonblocking(true),
-			ants.WithExpiryDuration(time.Hour*24))
-	})
-	return gPool, err
-}
-
 type TaskType int
 
+// taskFn 内部统一的任务处理函数, params 为 AddTask 传入的参数
+type taskFn func(ctx context.Context, params interface{}) (interface{}, error)
+
 type task struct {
-	params   map[string]interface{}
+	//id AddTask 时生成, label 可以重复
+	id       string
+	params   interface{}
 	taskType TaskType
 	label    string
+	priority int
+	//index 在这一批中的位置, 用于按添加顺序返回结果
+	index int
+	//depList 依赖的任务 label, buildParams 用依赖的结果生成参数
+	depList     []string
+	buildParams func(depRetList map[string]interface{}) interface{}
 }
+
+// TaskPool 可以在多个协程中同时 AddTask 和 Start, 每次 Start 执行之前加入的任务, 结果按批次保存
 type TaskPool struct {
-	taskCount int
-	fn        map[TaskType]func(ctx context.Context, params map[string]interface{}) (interface{}, error)
-	ctx       context.Context
-	taskList  []*task
-	errList   map[string]error
-	retList   map[string]interface{}
+	//lock 保护任务列表, 处理函数, 配置和批次
+	lock     sync.RWMutex
+	fn       map[TaskType]taskFn
+	ctx      context.Context
+	taskList []*task
+	//labelSet 还没执行的任务的 label, 用于拒绝重复的 label
+	labelSet             map[string]bool
+	rejectDuplicateLabel bool
+	//hasDeps 还没执行的任务中有声明依赖的, dupLabel 第一个重复的 label, 两者不能同时存在
+	hasDeps  bool
+	dupLabel string
+	//batch 最近一次 Start 的批次, batchMap 按批次 ID 保存, Clear 后清空
+	batch    *Batch
+	batchMap map[string]*Batch
+	//batchIDList 按 Start 的顺序, 超过 batchRetention 时删除最早的批次
+	batchIDList    []string
+	batchRetention int
+	//pool 为空时, 设置了 poolSize 或 poolOpts 第一次 Start 创建自己的协程池, 否则使用默认共享的协程池
+	pool     *WorkerPool
+	ownPool  bool
+	poolSize int
+	poolOpts []WorkerPoolOption
+	//poolName 自己的协程池在指标中的名字
+	poolName string
+	//sem 限制同时执行的任务数
+	sem            chan struct{}
+	limiterMap     map[TaskType]*tokenBucket
+	blockingSubmit bool
+	//timeout 整批任务的超时, taskTimeout 单个任务的超时
+	timeout        time.Duration
+	taskTimeout    time.Duration
+	taskTimeoutMap map[TaskType]time.Duration
+	failFast       bool
+	panicHandler   func(ctx context.Context, err *PanicError)
+	rePanic        bool
+	//retryMap 按任务类型的重试策略
+	retryMap map[TaskType]retry.Interface
+	//weightMap 按任务类型叠加到任务优先级上
+	weightMap map[TaskType]int
+	queue     Queue
+	trace     Trace
+}
+
+// runState 一次 Start 的执行上下文
+type runState struct {
+	batch    *Batch
+	taskList []*task
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	//stop 释放整批超时的 ctx
+	stop func()
+	wg   sync.WaitGroup
+	//resultCh 流式返回结果, 为空时不返回
+	resultCh chan TaskResult
+	//panicErr 第一个 panic 的任务, 用于 SetRePanic
+	panicErr *PanicError
+	pool     *WorkerPool
+	//Start 时的配置, 执行中修改不影响这一批
+	sem            chan struct{}
+	failFast       bool
+	blockingSubmit bool
+	rePanic        bool
+	//以下由 batch.lock 保护
+	graph   *taskGraph
+	doneMap map[*task]bool
 }
 
 func GetTaskPool(ctx context.Context) *TaskPool {
 	return &TaskPool{
-		ctx:      ctx,
-		taskList: make([]*task, 0, 8),
-		errList:  make(map[string]error),
-		retList:  make(map[string]interface{}),
-		fn:       make(map[TaskType]func(ctx context.Context, params map[string]interface{}) (interface{}, error)),
+		ctx:            ctx,
+		taskList:       make([]*task, 0, 8),
+		labelSet:       make(map[string]bool),
+		batch:          newBatch("", nil),
+		batchMap:       make(map[string]*Batch),
+		batchRetention: defaultBatchRetention,
+		fn:             make(map[TaskType]taskFn),
+		limiterMap:     make(map[TaskType]*tokenBucket),
+		taskTimeoutMap: make(map[TaskType]time.Duration),
+		retryMap:       make(map[TaskType]retry.Interface),
+		weightMap:      make(map[TaskType]int),
 	}
 }
 
+// SetPoolSize 使用自己的协程池并设置大小, 协程池已创建时直接调整容量, 用完需要 Release
+// 小于等于 0 时关闭自己的协程池, 回到默认共享的协程池
+func (t *TaskPool) SetPoolSize(size int) {
+	t.lock.Lock()
+	t.poolSize = size
+	if size <= 0 {
+		ownPool := t.takeOwnPool()
+		t.lock.Unlock()
+		if ownPool != nil {
+			ownPool.Release()
+		}
+		return
+	}
+	if t.pool != nil && t.ownPool {
+		t.pool.Tune(size)
+	}
+	t.lock.Unlock()
+}
+
+// SetGPoolSize Deprecated: 使用 SetPoolSize
 func (t *TaskPool) SetGPoolSize(size int) {
-	gPoolSize = size
+	t.SetPoolSize(size)
+}
+
+// SetPoolOptions 使用自己的协程池并设置参数, 比如阻塞提交, 在第一次 Start 前设置, 用完需要 Release
+func (t *TaskPool) SetPoolOptions(opts ...WorkerPoolOption) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.poolOpts = opts
+}
+
+// SetPoolName 自己的协程池在指标中的名字, 不能和其他协程池重复, 默认为 taskpool- 加随机 ID, 在第一次 Start 前设置
+func (t *TaskPool) SetPoolName(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.poolName = name
+}
+
+// SetWorkerPool 使用共享的协程池, Release 时不会关闭共享的协程池
+func (t *TaskPool) SetWorkerPool(pool *WorkerPool) {
+	t.lock.Lock()
+	ownPool := t.takeOwnPool()
+	t.pool = pool
+	t.lock.Unlock()
+	if ownPool != nil {
+		ownPool.Release()
+	}
+}
+
+// Release 关闭自己的协程池, 之后再 Start 会重新创建
+func (t *TaskPool) Release() {
+	t.lock.Lock()
+	ownPool := t.takeOwnPool()
+	t.lock.Unlock()
+	if ownPool != nil {
+		ownPool.Release()
+	}
+}
+
+// ReleaseTimeout 关闭自己的协程池并等待执行中的任务结束
+func (t *TaskPool) ReleaseTimeout(timeout time.Duration) error {
+	t.lock.Lock()
+	ownPool := t.takeOwnPool()
+	t.lock.Unlock()
+	if ownPool != nil {
+		return ownPool.ReleaseTimeout(timeout)
+	}
+	return nil
+}
+
+// takeOwnPool 调用方持有 lock, 返回的协程池在锁外关闭, 避免执行中的任务读取配置时阻塞
+func (t *TaskPool) takeOwnPool() *WorkerPool {
+	pool, ownPool := t.pool, t.ownPool
+	t.pool = nil
+	t.ownPool = false
+	if ownPool {
+		privatePoolMap.CompareAndDelete(t.poolName, pool)
+		return pool
+	}
+	return nil
+}
+
+// SetMaxConcurrency 限制这个任务池同时执行的任务数, 共享协程池时避免占满协程池, 小于等于 0 表示不限制
+func (t *TaskPool) SetMaxConcurrency(maxConcurrency int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if maxConcurrency <= 0 {
+		t.sem = nil
+		return
+	}
+	t.sem = make(chan struct{}, maxConcurrency)
+}
+
+// SetRateLimit 按任务类型限速, 每秒最多开始 rate 个任务, 允许突发 burst 个
+func (t *TaskPool) SetRateLimit(taskType TaskType, rate float64, burst int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if rate <= 0 {
+		delete(t.limiterMap, taskType)
+		return
+	}
+	t.limiterMap[taskType] = newTokenBucket(rate, burst)
+}
+
+// SetBlockingSubmit 协程池满了等待空闲后重试提交, 不再返回 ErrPoolOverload
+func (t *TaskPool) SetBlockingSubmit(blockingSubmit bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.blockingSubmit = blockingSubmit
+}
+
+// SetTimeout 整批任务的超时, 超时后没开始的任务不再执行, 执行中的任务 ctx 被取消, 小于等于 0 表示不限制
+func (t *TaskPool) SetTimeout(timeout time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timeout = timeout
+}
+
+// SetTaskTimeout 单个任务的超时, 超时的任务记为失败
+func (t *TaskPool) SetTaskTimeout(timeout time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.taskTimeout = timeout
+}
+
+// SetTaskTypeTimeout 按任务类型设置单个任务的超时, 优先于 SetTaskTimeout
+func (t *TaskPool) SetTaskTypeTimeout(taskType TaskType, timeout time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if timeout <= 0 {
+		delete(t.taskTimeoutMap, taskType)
+		return
+	}
+	t.taskTimeoutMap[taskType] = timeout
+}
+
+// SetFailFast 第一个任务失败后取消其他任务, 类似 errgroup
+func (t *TaskPool) SetFailFast(failFast bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.failFast = failFast
+}
+
+// SetRetry 按任务类型设置重试策略, 失败的任务在协程池中按策略重试, 单个任务的超时包含所有重试
+// 每次重试的超时使用重试策略的配置, 比如 retry.WithMaxTimesAttemptTimeout
+func (t *TaskPool) SetRetry(taskType TaskType, strategy retry.Strategy, options ...retry.OptionFn) error {
+	retryHelper, err := retry.GetRetryHelper(strategy, options...)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.retryMap[taskType] = retryHelper
+	return nil
+}
+
+// getTaskTimeout 调用方持有 lock
+func (t *TaskPool) getTaskTimeout(taskType TaskType) time.Duration {
+	if timeout, ok := t.taskTimeoutMap[taskType]; ok {
+		return timeout
+	}
+	return t.taskTimeout
+}
+
+func (t *TaskPool) getWorkerPool() (*WorkerPool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.pool != nil {
+		return t.pool, nil
+	}
+	if t.poolSize <= 0 && len(t.poolOpts) == 0 {
+		return getDefaultWorkerPool()
+	}
+	size := t.poolSize
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	pool, err := NewWorkerPool(size, t.poolOpts...)
+	if err != nil {
+		return nil, err
+	}
+	t.pool = pool
+	t.ownPool = true
+	if t.poolName == "" {
+		t.poolName = "taskpool-" + uuid.NewV4().String()[:8]
+	}
+	privatePoolMap.Store(t.poolName, pool)
+	return pool, nil
 }
 
 func (t *TaskPool) SetTaskHandlerFunc(taskType TaskType, fn func(ctx context.Context, params map[string]interface{}) (interface{}, error)) {
-	t.fn[taskType] = fn
+	t.setTaskFn(taskType, func(ctx context.Context, params interface{}) (interface{}, error) {
+		p, _ := params.(map[string]interface{})
+		return fn(ctx, p)
+	})
 }
 
 func (t *TaskPool) SetTaskHandler(taskHandler TaskHandlerI) {
-	t.fn[taskHandler.GetTaskType()] = taskHandler.GetTaskFn()
+	t.SetTaskHandlerFunc(taskHandler.GetTaskType(), taskHandler.GetTaskFn())
 }
-func (t *TaskPool) AddTask(taskType TaskType, label string, params map[string]interface{}) {
-	t.taskList = append(t.taskList, &task{
-		taskType: taskType,
-		label:    label,
-		params:   params,
-	})
-	t.taskCount++
+
+// AddTask 执行中也可以调用, 加入下一次 Start, 返回任务 ID
+// label 重复时按 label 的结果只保留最后一个, 按 ID 或 GetResultList 获取全部结果
+// 同一批中有 AddTaskWithDeps 的任务时依赖按 label 查找, 重复的 label 返回 ErrDuplicateLabel
+func (t *TaskPool) AddTask(taskType TaskType, label string, params map[string]interface{}) (string, error) {
+	return t.addTask(&task{taskType: taskType, label: label, params: params})
+}
+
+// AddTaskWithPriority 优先级越大越先提交, 共享的协程池使用 WithPriorityQueue 时在多个任务池之间也按优先级执行
+// SetRateLimit 限速的任务类型单独提交, 优先级只在这个类型内生效
+func (t *TaskPool) AddTaskWithPriority(taskType TaskType, label string, params map[string]interface{}, priority int) (string, error) {
+	return t.addTask(&task{taskType: taskType, label: label, params: params, priority: priority})
+}
+
+// SetRejectDuplicateLabel 同一批中 label 重复时 AddTask 返回 ErrDuplicateLabel
+func (t *TaskPool) SetRejectDuplicateLabel(reject bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.rejectDuplicateLabel = reject
+}
+
+// SetTaskTypeWeight 任务类型的权重, 叠加到这个类型每个任务的优先级上
+func (t *TaskPool) SetTaskTypeWeight(taskType TaskType, weight int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.weightMap[taskType] = weight
 }
 
+func (t *TaskPool) getPriority(task *task) int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return task.priority + t.weightMap[task.taskType]
+}
+
+func (t *TaskPool) setTaskFn(taskType TaskType, fn taskFn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.fn[taskType] = fn
+}
+
+func (t *TaskPool) getTaskFn(taskType TaskType) (taskFn, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	fn, ok := t.fn[taskType]
+	return fn, ok
+}
+
+func (t *TaskPool) getLimiter(taskType TaskType) (*tokenBucket, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	limiter, ok := t.limiterMap[taskType]
+	return limiter, ok
+}
+
+func (t *TaskPool) addTask(task *task) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	hasDeps := len(task.depList) > 0
+	dup := t.labelSet[task.label]
+	if dup && (t.rejectDuplicateLabel || t.hasDeps || hasDeps) {
+		return "", fmt.Errorf("%w: %s", ErrDuplicateLabel, task.label)
+	}
+	if hasDeps && t.dupLabel != "" {
+		return "", fmt.Errorf("%w: %s", ErrDuplicateLabel, t.dupLabel)
+	}
+	if dup && t.dupLabel == "" {
+		t.dupLabel = task.label
+	}
+	t.hasDeps = t.hasDeps || hasDeps
+	task.id = uuid.NewV4().String()
+	t.labelSet[task.label] = true
+	t.taskList = append(t.taskList, task)
+	return task.id, nil
+}
+
+// Start 执行所有任务, ctx 取消, 整批超时或快速失败后剩下的任务记为取消
+// 执行中的任务通过 ctx 感知取消, Start 会等待它们返回
 func (t *TaskPool) Start() error {
+	_, err := t.StartBatch()
+	return err
+}
 
-	if t.taskCount == 0 {
-		return errors.New("当前没有任务")
+// prepare 取出当前的任务作为新的一批
+func (t *TaskPool) prepare() (*runState, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.taskList) == 0 {
+		return nil, errors.New("当前没有任务")
 	}
 
 	if t.fn == nil {
-		return errors.New("当前没有配置处理任务函数")
+		return nil, errors.New("当前没有配置处理任务函数")
 	}
 
-	//todo  ratelimit
-	wg := sync.WaitGroup{}
-	errCh := make(chan map[string]error, t.taskCount*2)
-	retCh := make(chan map[string]interface{}, t.taskCount)
+	graph, err := buildTaskGraph(t.taskList)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, task := range t.taskList {
-		fn, ok := t.fn[task.taskType]
-		if !ok {
-			errCh <- map[string]error{task.label: errors.New("当前任务类型没有配置处理函数")}
+	ctx, cancel := context.WithCancelCause(t.ctx)
+	run := &runState{
+		batch:          newBatch(uuid.NewV4().String(), t.taskList),
+		taskList:       t.taskList,
+		ctx:            ctx,
+		cancel:         cancel,
+		stop:           func() {},
+		sem:            t.sem,
+		failFast:       t.failFast,
+		blockingSubmit: t.blockingSubmit,
+		rePanic:        t.rePanic,
+		graph:          graph,
+		doneMap:        make(map[*task]bool, len(t.taskList)),
+	}
+	if t.timeout > 0 {
+		run.ctx, run.stop = context.WithTimeout(ctx, t.timeout)
+	}
+
+	//执行中加入的任务留到下一批
+	t.taskList = make([]*task, 0, 8)
+	t.labelSet = make(map[string]bool)
+	t.hasDeps = false
+	t.dupLabel = ""
+	t.batch = run.batch
+	t.batchMap[run.batch.ID] = run.batch
+	t.batchIDList = append(t.batchIDList, run.batch.ID)
+	t.trimBatch()
+	return run, nil
+}
+
+func (t *TaskPool) run(run *runState) {
+	defer run.cancel(nil)
+	defer run.stop()
+
+	//优先级高的先提交
+	taskList := make([]*task, len(run.taskList))
+	copy(taskList, run.taskList)
+	sort.SliceStable(taskList, func(i, j int) bool {
+		return t.getPriority(taskList[i]) > t.getPriority(taskList[j])
+	})
+
+	//没有限速的任务在一个协程中按优先级提交, 整批都按优先级
+	//限速的任务类型单独提交, 被限速时不影响其他类型, 优先级只在这个类型内生效
+	submitList := make([][]*task, 1)
+	limitedMap := make(map[TaskType]int)
+	for _, task := range taskList {
+		if _, ok := t.getTaskFn(task.taskType); !ok {
+			t.recordErr(run, task, errors.New("当前任务类型没有配置处理函数"))
 			continue
 		}
-		wg.Add(1)
-		taskCopy := task
-		gPool, err := getGPoolInstance()
-		if err != nil {
-			errCh <- map[string]error{task.label: err}
-			wg.Done()
+		//有依赖的任务在依赖都成功后提交
+		if len(task.depList) > 0 {
+			continue
+		}
+		if _, ok := t.getLimiter(task.taskType); !ok {
+			submitList[0] = append(submitList[0], task)
 			continue
 		}
+		idx, ok := limitedMap[task.taskType]
+		if !ok {
+			idx = len(submitList)
+			limitedMap[task.taskType] = idx
+			submitList = append(submitList, nil)
+		}
+		submitList[idx] = append(submitList[idx], task)
+	}
 
-		if err := gPool.Submit(func() {
-			defer func() {
-				if r := recover(); r != nil {
-					errCh <- map[string]error{taskCopy.label: errors.New("TaskPool Do Task Error")}
+	pool, err := t.getWorkerPool()
+	if err != nil {
+		for _, taskList := range submitList {
+			for _, task := range taskList {
+				t.recordErr(run, task, err)
+			}
+		}
+		return
+	}
+	run.pool = pool
+
+	submitWg := sync.WaitGroup{}
+	for _, taskList := range submitList {
+		if len(taskList) == 0 {
+			continue
+		}
+		submitWg.Add(1)
+		go func(taskList []*task) {
+			defer submitWg.Done()
+			for _, task := range taskList {
+				if err := t.submit(run, pool, task); err != nil {
+					t.recordErr(run, task, err)
 				}
-				wg.Done()
-			}()
-
-			data, err := fn(t.ctx, taskCopy.params)
-			errCh <- map[string]error{taskCopy.label: err}
-			retCh <- map[string]interface{}{taskCopy.label: data}
-		}); err != nil {
-			errCh <- map[string]error{task.label: err}
-			wg.Done()
+			}
+		}(taskList)
+	}
+	submitWg.Wait()
+	run.wg.Wait()
+}
+
+func (t *TaskPool) checkRePanic(run *runState) {
+	if run.rePanic && run.panicErr != nil {
+		panic(run.panicErr)
+	}
+}
+
+// submit 等待限速和并发数后提交任务, 阻塞提交时协程池满了会一直等到提交成功
+func (t *TaskPool) submit(run *runState, pool *WorkerPool, task *task) error {
+	if err := run.ctx.Err(); err != nil {
+		return err
+	}
+	if limiter, ok := t.getLimiter(task.taskType); ok {
+		if err := limiter.Wait(run.ctx); err != nil {
+			return err
 		}
 	}
 
-	wg.Wait()
+	if run.sem != nil {
+		select {
+		case run.sem <- struct{}{}:
+		case <-run.ctx.Done():
+			return run.ctx.Err()
+		}
+	}
+	release := func() {
+		if run.sem != nil {
+			<-run.sem
+		}
+	}
 
-	for len(errCh) > 0 {
-		tmp := <-errCh
-		for idx, item := range tmp {
-			t.errList[idx] = item
+	submitAt := time.Now()
+	fn := func() {
+		startAt := time.Now()
+		if trace := t.getTrace(); trace != nil {
+			trace.TaskStart(task.taskType, task.label, startAt.Sub(submitAt))
 		}
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = t.handlePanic(run, task, r)
+			}
+			if trace := t.getTrace(); trace != nil {
+				trace.TaskFinish(task.taskType, task.label, t.taskStatus(run, err), time.Since(startAt), err)
+			}
+			release()
+			run.wg.Done()
+		}()
+		err = t.do(run, task)
 	}
-	close(errCh)
 
-	for len(retCh) > 0 {
-		tmp := <-retCh
-		for idx, item := range tmp {
-			t.retList[idx] = item
+	if trace := t.getTrace(); trace != nil {
+		trace.TaskSubmit(task.taskType, task.label)
+	}
+	run.wg.Add(1)
+	if pool.priority {
+		//进入优先级队列 出队后没能执行时记录错误
+		err := pool.submitPriority(fn, t.getPriority(task), func(err error) {
+			t.traceReject(task.taskType, task.label, err)
+			t.recordErr(run, task, err)
+			release()
+			run.wg.Done()
+		})
+		if err != nil {
+			t.traceReject(task.taskType, task.label, err)
+			release()
+			run.wg.Done()
+		}
+		return err
+	}
+	var err error
+	if run.blockingSubmit {
+		//协程池满了等有任务结束后再提交
+		err = pool.submitWait(run.ctx, fn)
+	} else {
+		err = pool.Submit(fn)
+	}
+	if err != nil {
+		if !errors.Is(err, run.ctx.Err()) {
+			t.traceReject(task.taskType, task.label, err)
 		}
+		release()
+		run.wg.Done()
 	}
-	close(retCh)
+	return err
+}
 
-	return nil
+func (t *TaskPool) do(run *runState, task *task) error {
+	//在协程池中排队时已被取消
+	if err := run.ctx.Err(); err != nil {
+		t.recordErr(run, task, err)
+		return err
+	}
+
+	params := task.params
+	if task.buildParams != nil {
+		params = task.buildParams(t.getDepRetList(run, task))
+	}
+	data, attempts, err := t.execute(run.ctx, task.taskType, params)
+	t.recordRet(run, task, data, err, attempts)
+	return err
 }
 
+// execute 按任务类型的超时和重试策略执行处理函数, 返回执行次数
+func (t *TaskPool) execute(ctx context.Context, taskType TaskType, params interface{}) (interface{}, int, error) {
+	t.lock.RLock()
+	fn := t.fn[taskType]
+	timeout := t.getTaskTimeout(taskType)
+	retryHelper, ok := t.retryMap[taskType]
+	t.lock.RUnlock()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	attempts := 0
+	call := func(ctx context.Context) (interface{}, error) {
+		attempts++
+		return fn(ctx, params)
+	}
+	if !ok {
+		data, err := call(ctx)
+		return data, attempts, err
+	}
+	//取消后不再等待和重试
+	data, err := retryHelper.DoRetryReturnCtx(ctx, call)
+	return data, attempts, err
+}
+
+// taskStatus 整批已取消时 ctx 相关的错误记为取消, 否则记为失败
+func (t *TaskPool) taskStatus(run *runState, err error) TaskStatus {
+	if err == nil {
+		return TaskStatusSucceeded
+	}
+	if run.ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return TaskStatusCancelled
+	}
+	return TaskStatusFailed
+}
+
+func (t *TaskPool) recordErr(run *runState, task *task, err error) {
+	run.batch.lock.Lock()
+	defer run.batch.lock.Unlock()
+	run.batch.errList[task.label] = err
+	t.recordStatus(run, task, nil, err)
+}
+
+func (t *TaskPool) recordRet(run *runState, task *task, data interface{}, err error, attempts int) {
+	run.batch.lock.Lock()
+	defer run.batch.lock.Unlock()
+	run.batch.attemptList[task.label] = attempts
+	run.batch.resultList[task.index].Attempts = attempts
+	run.batch.errList[task.label] = err
+	run.batch.retList[task.label] = data
+	t.recordStatus(run, task, data, err)
+}
+
+// recordStatus 调用方持有 batch.lock, 每个任务只会调用一次
+func (t *TaskPool) recordStatus(run *runState, task *task, data interface{}, err error) {
+	t.finish(run, task, data, err, t.taskStatus(run, err))
+}
+
+// finish 调用方持有 batch.lock
+func (t *TaskPool) finish(run *runState, task *task, data interface{}, err error, status TaskStatus) {
+	if run.doneMap[task] {
+		return
+	}
+	run.doneMap[task] = true
+	batch := run.batch
+	batch.statusList[task.label] = status
+	batch.progress.add(status)
+	ret := TaskResult{
+		BatchID:  batch.ID,
+		ID:       task.id,
+		Label:    task.label,
+		TaskType: task.taskType,
+		Ret:      data,
+		Err:      err,
+		Status:   status,
+		Attempts: batch.resultList[task.index].Attempts,
+	}
+	batch.resultList[task.index] = ret
+	if run.resultCh != nil {
+		//缓冲区等于任务数 不会阻塞
+		run.resultCh <- ret
+	}
+	if status == TaskStatusFailed && batch.firstErr == nil {
+		batch.firstErrLabel = task.label
+		batch.firstErr = err
+		if run.failFast {
+			run.cancel(err)
+		}
+	}
+	t.releaseDependents(run, task, status)
+}
+
+// GetRetList 最近一次 Start 的结果, 指定批次使用 GetBatch
 func (t *TaskPool) GetRetList() map[string]interface{} {
-	return t.retList
+	return t.LastBatch().GetRetList()
 }
 
 func (t *TaskPool) GetErrList() map[string]error {
-	return t.errList
+	return t.LastBatch().GetErrList()
 }
 
+// GetStatusList 每个任务的状态
+func (t *TaskPool) GetStatusList() map[string]TaskStatus {
+	return t.LastBatch().GetStatusList()
+}
+
+// GetAttemptList 每个任务执行的次数, 没有执行的任务为 0
+func (t *TaskPool) GetAttemptList() map[string]int {
+	return t.LastBatch().GetAttemptList()
+}
+
+// GetResultList 最近一次 Start 的结果, 按 AddTask 的顺序
+func (t *TaskPool) GetResultList() []TaskResult {
+	return t.LastBatch().GetResultList()
+}
+
+// FirstErr 优先返回最先失败的任务的错误
 func (t *TaskPool) FirstErr() error {
-	for key, err := range t.errList {
-		if err != nil {
-			return errors.New(fmt.Sprintf("key %s : %s", key, err.Error()))
-		}
-	}
-	return nil
+	return t.LastBatch().FirstErr()
 }
 
+// Clear 清空还没执行的任务和所有批次的结果, 执行中的批次不受影响
 func (t *TaskPool) Clear(ctx context.Context) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	t.ctx = ctx
 	t.taskList = make([]*task, 0, 8)
-	t.errList = make(map[string]error)
-	t.retList = make(map[string]interface{})
+	t.labelSet = make(map[string]bool)
+	t.hasDeps = false
+	t.dupLabel = ""
+	t.batch = newBatch("", nil)
+	t.batchMap = make(map[string]*Batch)
+	t.batchIDList = nil
 }
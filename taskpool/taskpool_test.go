@@ -0,0 +1,794 @@
+package taskpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graymonster0927/component/retry"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	taskTypeTestEcho TaskType = iota + 1
+	taskTypeTestErr
+	taskTypeTestSleep
+)
+
+func TestTaskPool_Start(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return params["v"], nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("test error")
+	})
+
+	taskPool.AddTask(taskTypeTestEcho, "echo", map[string]interface{}{"v": 1})
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if taskPool.GetRetList()["echo"] != 1 {
+		t.Errorf("Expected echo 1, got %v", taskPool.GetRetList()["echo"])
+	}
+	if taskPool.GetErrList()["err"] == nil || taskPool.FirstErr() == nil {
+		t.Errorf("Expected error for err task, got %v", taskPool.GetErrList())
+	}
+}
+
+func TestTaskPool_Batch(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return params["v"], nil
+	})
+
+	taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 1})
+	first, err := taskPool.StartBatch()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	//执行过的任务不会再次执行
+	taskPool.AddTask(taskTypeTestEcho, "b", map[string]interface{}{"v": 2})
+	second, err := taskPool.StartBatch()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if second.GetProgress().Total != 1 || len(second.GetRetList()) != 1 || second.GetRetList()["b"] != 2 {
+		t.Errorf("Expected only b in second batch, got %v", second.GetRetList())
+	}
+	if batch, ok := taskPool.GetBatch(first.ID); !ok || batch.GetRetList()["a"] != 1 {
+		t.Errorf("Expected first batch kept, got %v", batch)
+	}
+	if taskPool.GetRetList()["b"] != 2 {
+		t.Errorf("Expected GetRetList return last batch, got %v", taskPool.GetRetList())
+	}
+
+	//超过保留数时删除最早的批次
+	taskPool.SetBatchRetention(1)
+	if _, ok := taskPool.GetBatch(first.ID); ok {
+		t.Errorf("Expected first batch evicted")
+	}
+	if _, ok := taskPool.GetBatch(second.ID); !ok {
+		t.Errorf("Expected second batch kept")
+	}
+
+	//Clear 后没有任务 结果也被清空
+	taskPool.AddTask(taskTypeTestEcho, "c", nil)
+	taskPool.Clear(context.Background())
+	if err := taskPool.Start(); err == nil {
+		t.Errorf("Expected no task error after Clear")
+	}
+	if _, ok := taskPool.GetBatch(first.ID); ok || len(taskPool.GetRetList()) != 0 {
+		t.Errorf("Expected batches cleared")
+	}
+}
+
+func TestTaskPool_ResultList(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		time.Sleep(time.Duration(5-params["v"].(int)) * time.Millisecond)
+		return params["v"], nil
+	})
+
+	//label 重复时结果按添加顺序各自保留
+	idList := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		id, err := taskPool.AddTask(taskTypeTestEcho, "same", map[string]interface{}{"v": i})
+		if err != nil || id == "" {
+			t.Fatalf("Expected task id, got %q %v", id, err)
+		}
+		idList = append(idList, id)
+	}
+	batch, err := taskPool.StartBatch()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resultList := taskPool.GetResultList()
+	if len(resultList) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(resultList))
+	}
+	for i, ret := range resultList {
+		if ret.ID != idList[i] || ret.Ret != i || ret.Status != TaskStatusSucceeded || ret.Attempts != 1 {
+			t.Errorf("Expected result %d in order, got %+v", i, ret)
+		}
+	}
+	if ret, ok := batch.GetResult(idList[2]); !ok || ret.Ret != 2 {
+		t.Errorf("Expected result by id, got %+v", ret)
+	}
+
+	taskPool.SetRejectDuplicateLabel(true)
+	_, _ = taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 1})
+	if _, err := taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 2}); !errors.Is(err, ErrDuplicateLabel) {
+		t.Errorf("Expected ErrDuplicateLabel, got %v", err)
+	}
+	//下一批可以再用同样的 label
+	_ = taskPool.Start()
+	if _, err := taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 3}); err != nil {
+		t.Errorf("Expected label reusable in next batch, got %v", err)
+	}
+}
+
+func TestTaskPool_Concurrent(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return params["v"], nil
+	})
+
+	//多个协程同时添加任务和执行 每个任务只在一个批次中执行一次
+	var count atomic.Int32
+	batchCh := make(chan *Batch, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				taskPool.AddTask(taskTypeTestEcho, fmt.Sprintf("%d-%d", i, j), map[string]interface{}{"v": j})
+				if batch, err := taskPool.StartBatch(); err == nil {
+					batchCh <- batch
+				}
+				_ = taskPool.GetProgress()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(batchCh)
+
+	labelMap := make(map[string]bool)
+	for batch := range batchCh {
+		for label := range batch.GetRetList() {
+			if labelMap[label] {
+				t.Errorf("Expected %s executed once", label)
+			}
+			labelMap[label] = true
+			count.Add(1)
+		}
+	}
+	if count.Load() != 100 {
+		t.Errorf("Expected 100 tasks executed, got %d", count.Load())
+	}
+}
+
+func TestTaskPool_IsolatedPool(t *testing.T) {
+	small := GetTaskPool(context.Background())
+	defer small.Release()
+	small.SetPoolSize(1)
+	small.SetPoolOptions(WithNonblocking(false))
+	small.SetTaskHandlerFunc(taskTypeTestSleep, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	})
+	for _, label := range []string{"a", "b", "c"} {
+		small.AddTask(taskTypeTestSleep, label, nil)
+	}
+
+	st := time.Now()
+	if err := small.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if time.Since(st) < 60*time.Millisecond {
+		t.Errorf("Expected tasks run one by one, cost %v", time.Since(st))
+	}
+	if err := small.FirstErr(); err != nil {
+		t.Errorf("Expected blocking submission without overload, got %v", err)
+	}
+
+	//调整容量后立即生效, 不影响其他 TaskPool
+	small.SetPoolSize(3)
+	if small.pool.Cap() != 3 {
+		t.Errorf("Expected cap 3, got %d", small.pool.Cap())
+	}
+	other := GetTaskPool(context.Background())
+	defer other.Release()
+	pool, err := other.getWorkerPool()
+	if err != nil || pool.Cap() != 5000 {
+		t.Errorf("Expected default cap 5000, got %v %v", pool, err)
+	}
+}
+
+func TestTaskPool_DefaultPool(t *testing.T) {
+	run := func() {
+		taskPool := GetTaskPool(context.Background())
+		taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		taskPool.AddTask(taskTypeTestEcho, "a", nil)
+		if err := taskPool.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	run()
+	before := runtime.NumGoroutine()
+	//不调用 Release 也不会留下协程
+	for i := 0; i < 100; i++ {
+		run()
+	}
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("Expected default pool shared, goroutines %d -> %d", before, after)
+	}
+}
+
+func TestWorkerPool_PriorityUnlimited(t *testing.T) {
+	pool, err := NewWorkerPool(-1, WithPriorityQueue(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+	done := make(chan struct{})
+	if err := pool.SubmitWithPriority(func() { close(done) }, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected task executed with unlimited capacity")
+	}
+}
+
+func TestWorkerPool_SubmitWait(t *testing.T) {
+	pool, err := NewWorkerPool(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+	//容量为 1 时连续提交, 每次都要等上一个任务结束
+	var count atomic.Int32
+	for i := 0; i < 200; i++ {
+		if err := pool.submitWait(context.Background(), func() { count.Add(1) }); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	block := make(chan struct{})
+	if err := pool.submitWait(context.Background(), func() { <-block }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.submitWait(ctx, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	close(block)
+	done := make(chan struct{})
+	if err := pool.submitWait(context.Background(), func() { close(done) }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-done
+	if count.Load() != 200 {
+		t.Errorf("Expected 200 tasks executed, got %d", count.Load())
+	}
+}
+
+func TestTaskPool_FailFast(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetFailFast(true)
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("test error")
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestSleep, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		select {
+		case <-time.After(time.Second):
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+	for i := 0; i < 5; i++ {
+		taskPool.AddTask(taskTypeTestSleep, fmt.Sprintf("sleep%d", i), nil)
+	}
+
+	st := time.Now()
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if time.Since(st) > 500*time.Millisecond {
+		t.Errorf("Expected remaining tasks cancelled, cost %v", time.Since(st))
+	}
+	statusList := taskPool.GetStatusList()
+	if statusList["err"] != TaskStatusFailed {
+		t.Errorf("Expected err failed, got %v", statusList["err"])
+	}
+	for i := 0; i < 5; i++ {
+		if status := statusList[fmt.Sprintf("sleep%d", i)]; status != TaskStatusCancelled {
+			t.Errorf("Expected sleep%d cancelled, got %v", i, status)
+		}
+	}
+	if err := taskPool.FirstErr(); err == nil || err.Error() != "key err : test error" {
+		t.Errorf("Expected first error from err task, got %v", err)
+	}
+}
+
+func TestTaskPool_Timeout(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestSleep, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		select {
+		case <-time.After(params["d"].(time.Duration)):
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	//单个任务超时记为失败, 不影响其他任务
+	taskPool.SetTaskTimeout(20 * time.Millisecond)
+	taskPool.AddTask(taskTypeTestSleep, "fast", map[string]interface{}{"d": time.Millisecond})
+	taskPool.AddTask(taskTypeTestSleep, "slow", map[string]interface{}{"d": time.Second})
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	statusList := taskPool.GetStatusList()
+	if statusList["fast"] != TaskStatusSucceeded || statusList["slow"] != TaskStatusFailed {
+		t.Errorf("Expected fast succeeded and slow failed, got %v", statusList)
+	}
+	if !errors.Is(taskPool.GetErrList()["slow"], context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", taskPool.GetErrList()["slow"])
+	}
+
+	//整批超时记为取消
+	taskPool.Clear(context.Background())
+	taskPool.SetTaskTimeout(0)
+	taskPool.SetTimeout(20 * time.Millisecond)
+	taskPool.AddTask(taskTypeTestSleep, "slow", map[string]interface{}{"d": time.Second})
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if status := taskPool.GetStatusList()["slow"]; status != TaskStatusCancelled {
+		t.Errorf("Expected slow cancelled, got %v", status)
+	}
+}
+
+func TestTaskPool_Panic(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	panicCause := errors.New("panic cause")
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		panic(panicCause)
+	})
+	var handled atomic.Int32
+	taskPool.SetPanicHandler(func(ctx context.Context, err *PanicError) {
+		handled.Add(1)
+	})
+	taskPool.AddTask(taskTypeTestErr, "panic", nil)
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var panicErr *PanicError
+	if !errors.As(taskPool.GetErrList()["panic"], &panicErr) {
+		t.Fatalf("Expected PanicError, got %v", taskPool.GetErrList()["panic"])
+	}
+	if panicErr.Label != "panic" || panicErr.TaskType != taskTypeTestErr || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected label, type and stack recorded, got %+v", panicErr)
+	}
+	if !errors.Is(panicErr, panicCause) {
+		t.Errorf("Expected panic value unwrapped, got %v", panicErr.Value)
+	}
+	if handled.Load() != 1 || taskPool.GetStatusList()["panic"] != TaskStatusFailed {
+		t.Errorf("Expected panic handled once and failed, got %d %v", handled.Load(), taskPool.GetStatusList()["panic"])
+	}
+
+	//重新 panic 到调用方
+	taskPool.Clear(context.Background())
+	taskPool.SetRePanic(true)
+	taskPool.AddTask(taskTypeTestErr, "panic", nil)
+	func() {
+		defer func() {
+			if _, ok := recover().(*PanicError); !ok {
+				t.Errorf("Expected Start re-panic with PanicError")
+			}
+		}()
+		_ = taskPool.Start()
+	}()
+}
+
+func TestTaskPool_StartStream(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTaskHandlerFunc(taskTypeTestSleep, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		time.Sleep(params["d"].(time.Duration))
+		return params["d"], nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("test error")
+	})
+	taskPool.AddTask(taskTypeTestSleep, "slow", map[string]interface{}{"d": 100 * time.Millisecond})
+	taskPool.AddTask(taskTypeTestSleep, "fast", map[string]interface{}{"d": time.Millisecond})
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+
+	resultCh, err := taskPool.StartStream()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	labelList := make([]string, 0, 3)
+	for ret := range resultCh {
+		labelList = append(labelList, ret.Label)
+		if ret.Label == "fast" {
+			//慢任务还没结束时已经拿到快任务的结果
+			progress := taskPool.GetProgress()
+			if progress.Total != 3 || progress.Pending() == 0 {
+				t.Errorf("Expected slow task pending, got %+v", progress)
+			}
+		}
+		if ret.Label == "err" && (ret.Status != TaskStatusFailed || ret.Err == nil) {
+			t.Errorf("Expected err task failed, got %+v", ret)
+		}
+	}
+	if len(labelList) != 3 || labelList[2] != "slow" {
+		t.Errorf("Expected slow task last, got %v", labelList)
+	}
+	progress := taskPool.GetProgress()
+	if progress.Done != 3 || progress.Succeeded != 2 || progress.Failed != 1 {
+		t.Errorf("Expected all done, got %+v", progress)
+	}
+}
+
+func TestTaskPool_Deps(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	var running, maxRunning atomic.Int32
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		if n := running.Add(1); n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+		defer running.Add(-1)
+		time.Sleep(20 * time.Millisecond)
+		sum := params["v"].(int)
+		if depRetList, ok := params[DepRetListKey].(map[string]interface{}); ok {
+			for _, v := range depRetList {
+				sum += v.(int)
+			}
+		}
+		return sum, nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("test error")
+	})
+
+	//a, b 并行, c 使用两者的结果; err 失败后 d 以及依赖 d 的 e 被跳过
+	taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 1})
+	taskPool.AddTask(taskTypeTestEcho, "b", map[string]interface{}{"v": 2})
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "c", map[string]interface{}{"v": 3}, "a", "b")
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "d", map[string]interface{}{"v": 4}, "err", "c")
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "e", map[string]interface{}{"v": 5}, "d")
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if ret := taskPool.GetRetList()["c"]; ret != 6 {
+		t.Errorf("Expected c got results of a and b, got %v", ret)
+	}
+	if maxRunning.Load() != 2 {
+		t.Errorf("Expected a and b run in parallel, got %d", maxRunning.Load())
+	}
+	statusList := taskPool.GetStatusList()
+	if statusList["d"] != TaskStatusSkipped || statusList["e"] != TaskStatusSkipped {
+		t.Errorf("Expected d and e skipped, got %v", statusList)
+	}
+	if !errors.Is(taskPool.GetErrList()["d"], ErrDependencyFailed) {
+		t.Errorf("Expected ErrDependencyFailed, got %v", taskPool.GetErrList()["d"])
+	}
+
+	//有环时 Start 直接返回错误
+	taskPool.Clear(context.Background())
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "x", nil, "y")
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "y", nil, "x")
+	if err := taskPool.Start(); err == nil {
+		t.Errorf("Expected cycle error")
+	}
+
+	//有依赖时 label 不能重复
+	taskPool.Clear(context.Background())
+	taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 1})
+	taskPool.AddTask(taskTypeTestEcho, "a", map[string]interface{}{"v": 2})
+	if _, err := taskPool.AddTaskWithDeps(taskTypeTestEcho, "b", nil, "a"); !errors.Is(err, ErrDuplicateLabel) {
+		t.Errorf("Expected ErrDuplicateLabel, got %v", err)
+	}
+	taskPool.Clear(context.Background())
+	taskPool.AddTask(taskTypeTestEcho, "a", nil)
+	taskPool.AddTaskWithDeps(taskTypeTestEcho, "b", nil, "a")
+	if _, err := taskPool.AddTask(taskTypeTestEcho, "a", nil); !errors.Is(err, ErrDuplicateLabel) {
+		t.Errorf("Expected ErrDuplicateLabel, got %v", err)
+	}
+	if err := taskPool.Start(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestTaskPool_Retry(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	var calls atomic.Int32
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		//前两次失败
+		if calls.Add(1) < 3 {
+			return nil, errors.New("test error")
+		}
+		return "ok", nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("test error")
+	})
+	for _, taskType := range []TaskType{taskTypeTestEcho, taskTypeTestErr} {
+		err := taskPool.SetRetry(taskType, retry.RetryMaxTimes,
+			retry.WithMaxTimesMaxTimes(3),
+			retry.WithMaxTimesRetryTimeout(time.Millisecond))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	taskPool.AddTask(taskTypeTestEcho, "echo", nil)
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	attemptList := taskPool.GetAttemptList()
+	if attemptList["echo"] != 3 || taskPool.GetRetList()["echo"] != "ok" || taskPool.GetStatusList()["echo"] != TaskStatusSucceeded {
+		t.Errorf("Expected echo succeeded on 3rd attempt, got %d %v", attemptList["echo"], taskPool.GetErrList()["echo"])
+	}
+	if attemptList["err"] != 3 || taskPool.GetErrList()["err"] == nil {
+		t.Errorf("Expected err failed after 3 attempts, got %d %v", attemptList["err"], taskPool.GetErrList()["err"])
+	}
+}
+
+func TestTaskPool_PriorityAcrossTypes(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetPoolSize(1)
+	taskPool.SetPoolOptions(WithNonblocking(false))
+	orderCh := make(chan string, 8)
+	handler := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		orderCh <- params["name"].(string)
+		return nil, nil
+	}
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, handler)
+	taskPool.SetTaskHandlerFunc(taskTypeTestSleep, handler)
+	for i := 0; i < 3; i++ {
+		taskPool.AddTaskWithPriority(taskTypeTestEcho, fmt.Sprintf("low%d", i), map[string]interface{}{"name": "low"}, 0)
+	}
+	for i := 0; i < 3; i++ {
+		taskPool.AddTaskWithPriority(taskTypeTestSleep, fmt.Sprintf("high%d", i), map[string]interface{}{"name": "high"}, 10)
+	}
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	close(orderCh)
+	orderList := make([]string, 0, 6)
+	for name := range orderCh {
+		orderList = append(orderList, name)
+	}
+	if fmt.Sprint(orderList) != "[high high high low low low]" {
+		t.Errorf("Expected high priority tasks first across types, got %v", orderList)
+	}
+}
+
+func TestTaskPool_Priority(t *testing.T) {
+	pool, err := NewWorkerPool(1, WithPriorityQueue(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+	//占住唯一的协程, 之后提交的任务都进入队列
+	block := make(chan struct{})
+	_ = pool.Submit(func() {
+		<-block
+	})
+
+	orderCh := make(chan string, 8)
+	handler := func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		orderCh <- params["name"].(string)
+		return nil, nil
+	}
+	waitQueued := func(n int) {
+		for i := 0; i < 100 && pool.Waiting() < n; i++ {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	batch := GetTaskPool(context.Background())
+	batch.SetWorkerPool(pool)
+	batch.SetTaskHandlerFunc(taskTypeTestEcho, handler)
+	for i := 0; i < 5; i++ {
+		batch.AddTask(taskTypeTestEcho, fmt.Sprintf("batch%d", i), map[string]interface{}{"name": "batch"})
+	}
+	resultCh, err := batch.StartStream()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	waitQueued(5)
+
+	interactive := GetTaskPool(context.Background())
+	interactive.SetWorkerPool(pool)
+	interactive.SetTaskHandlerFunc(taskTypeTestEcho, handler)
+	interactive.SetTaskTypeWeight(taskTypeTestEcho, 10)
+	interactive.AddTask(taskTypeTestEcho, "interactive", map[string]interface{}{"name": "interactive"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = interactive.Start()
+	}()
+	waitQueued(6)
+
+	close(block)
+	<-done
+	for range resultCh {
+	}
+	if first := <-orderCh; first != "interactive" {
+		t.Errorf("Expected interactive task first, got %s", first)
+	}
+}
+
+func TestTaskPool_RateLimit(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetRateLimit(taskTypeTestEcho, 50, 1)
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	for i := 0; i < 6; i++ {
+		taskPool.AddTask(taskTypeTestEcho, fmt.Sprintf("echo-%d", i), nil)
+		taskPool.AddTask(taskTypeTestErr, fmt.Sprintf("other-%d", i), nil)
+	}
+
+	st := time.Now()
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if time.Since(st) < 100*time.Millisecond {
+		t.Errorf("Expected rate limited to 50/s, cost %v", time.Since(st))
+	}
+	if err := taskPool.FirstErr(); err != nil {
+		t.Errorf("Expected no task error, got %v", err)
+	}
+}
+
+func TestTaskPool_MaxConcurrencyAndBlockingSubmit(t *testing.T) {
+	pool, err := NewWorkerPool(2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer pool.Release()
+
+	taskPool := GetTaskPool(context.Background())
+	taskPool.SetWorkerPool(pool)
+	taskPool.SetBlockingSubmit(true)
+	taskPool.SetMaxConcurrency(3)
+
+	var running, maxRunning int32
+	taskPool.SetTaskHandlerFunc(taskTypeTestSleep, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil, nil
+	})
+	for i := 0; i < 10; i++ {
+		taskPool.AddTask(taskTypeTestSleep, fmt.Sprintf("sleep-%d", i), nil)
+	}
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := taskPool.FirstErr(); err != nil {
+		t.Errorf("Expected no overload with blocking submit, got %v", err)
+	}
+	if len(taskPool.GetRetList()) != 10 || maxRunning > 2 {
+		t.Errorf("Expected 10 results with at most 2 running, got %d and %d", len(taskPool.GetRetList()), maxRunning)
+	}
+}
+
+type testTypedHandler struct{}
+
+func (h *testTypedHandler) GetTaskType() TaskType {
+	return taskTypeTestErr
+}
+
+func (h *testTypedHandler) GetTaskFn() func(ctx context.Context, params int) (string, error) {
+	return func(ctx context.Context, params int) (string, error) {
+		return "", errors.New("test error")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	group := NewGroup[int, string](context.Background())
+	defer group.Release()
+	group.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params int) (string, error) {
+		return fmt.Sprintf("v-%d", params), nil
+	})
+	group.SetTaskHandler(&testTypedHandler{})
+
+	group.AddTask(taskTypeTestEcho, "a", 1)
+	group.AddTask(taskTypeTestEcho, "b", 2)
+	group.AddTask(taskTypeTestErr, "c", 3)
+	if err := group.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	retList := group.GetRetList()
+	if retList["a"] != "v-1" || retList["b"] != "v-2" || retList["c"] != "" {
+		t.Errorf("Unexpected results %v", retList)
+	}
+	if group.GetErrList()["c"] == nil {
+		t.Errorf("Expected error for c, got %v", group.GetErrList())
+	}
+}
+
+func TestGroup_StartWithCallback(t *testing.T) {
+	group := NewGroup[int, string](context.Background())
+	defer group.Release()
+	group.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params int) (string, error) {
+		return fmt.Sprintf("v-%d", params), nil
+	})
+	group.AddTask(taskTypeTestEcho, "a", 1)
+	group.AddTask(taskTypeTestEcho, "b", 2)
+
+	retList := make(map[string]string)
+	err := group.StartWithCallback(func(ret GroupResult[string]) {
+		retList[ret.Label] = ret.Ret
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if retList["a"] != "v-1" || retList["b"] != "v-2" {
+		t.Errorf("Unexpected results %v", retList)
+	}
+}
+
+func TestGroup_Deps(t *testing.T) {
+	group := NewGroup[int, int](context.Background())
+	defer group.Release()
+	group.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params int) (int, error) {
+		return params * 10, nil
+	})
+	group.AddTask(taskTypeTestEcho, "a", 1)
+	group.AddTaskWithDeps(taskTypeTestEcho, "b", func(depRetList map[string]int) int {
+		return depRetList["a"] + 1
+	}, "a")
+	if err := group.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ret := group.GetRetList()["b"]; ret != 110 {
+		t.Errorf("Expected 110, got %v", ret)
+	}
+}
@@ -0,0 +1,61 @@
+package taskpool
+
+import (
+	"time"
+)
+
+// Trace 任务执行的埋点, 在执行任务的协程中调用, 实现需要并发安全
+type Trace interface {
+	// TaskSubmit 通过限速和并发数后提交到协程池
+	TaskSubmit(taskType TaskType, label string)
+	// TaskStart 开始执行, wait 为提交后在协程池中排队的时间
+	TaskStart(taskType TaskType, label string, wait time.Duration)
+	TaskFinish(taskType TaskType, label string, status TaskStatus, cost time.Duration, err error)
+	TaskPanic(taskType TaskType, label string, err *PanicError)
+	// TaskReject 协程池满了或已关闭, 没有执行
+	TaskReject(taskType TaskType, label string, err error)
+}
+
+// SetTrace 设置埋点, 配合 MetricTrace 上报 prometheus
+func (t *TaskPool) SetTrace(trace Trace) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.trace = trace
+}
+
+func (t *TaskPool) getTrace() Trace {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.trace
+}
+
+func (t *TaskPool) traceReject(taskType TaskType, label string, err error) {
+	if trace := t.getTrace(); trace != nil {
+		trace.TaskReject(taskType, label, err)
+	}
+}
+
+// MetricTrace 使用前先调用 GetMetricCollectors 初始化并注册指标
+type MetricTrace struct {
+}
+
+func (m *MetricTrace) TaskSubmit(taskType TaskType, label string) {
+	TaskCounter.WithLabelValues(taskTypeLabel(taskType), "submit").Inc()
+}
+
+func (m *MetricTrace) TaskStart(taskType TaskType, label string, wait time.Duration) {
+	TaskHistory.WithLabelValues(taskTypeLabel(taskType), "wait").Observe(wait.Seconds())
+}
+
+func (m *MetricTrace) TaskFinish(taskType TaskType, label string, status TaskStatus, cost time.Duration, err error) {
+	TaskCounter.WithLabelValues(taskTypeLabel(taskType), status.String()).Inc()
+	TaskHistory.WithLabelValues(taskTypeLabel(taskType), "run").Observe(cost.Seconds())
+}
+
+func (m *MetricTrace) TaskPanic(taskType TaskType, label string, err *PanicError) {
+	TaskCounter.WithLabelValues(taskTypeLabel(taskType), "panic").Inc()
+}
+
+func (m *MetricTrace) TaskReject(taskType TaskType, label string, err error) {
+	TaskCounter.WithLabelValues(taskTypeLabel(taskType), "reject").Inc()
+}
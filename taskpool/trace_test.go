@@ -0,0 +1,167 @@
+package taskpool
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTrace struct {
+	lock      sync.Mutex
+	eventList []string
+	statusMap map[string]TaskStatus
+}
+
+func (tr *testTrace) add(event string) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.eventList = append(tr.eventList, event)
+}
+
+func (tr *testTrace) count(event string) int {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	n := 0
+	for _, e := range tr.eventList {
+		if e == event {
+			n++
+		}
+	}
+	return n
+}
+
+func (tr *testTrace) TaskSubmit(taskType TaskType, label string) {
+	tr.add("submit")
+}
+
+func (tr *testTrace) TaskStart(taskType TaskType, label string, wait time.Duration) {
+	tr.add("start")
+}
+
+func (tr *testTrace) TaskFinish(taskType TaskType, label string, status TaskStatus, cost time.Duration, err error) {
+	tr.add("finish")
+	tr.lock.Lock()
+	tr.statusMap[label] = status
+	tr.lock.Unlock()
+}
+
+func (tr *testTrace) TaskPanic(taskType TaskType, label string, err *PanicError) {
+	tr.add("panic")
+}
+
+func (tr *testTrace) TaskReject(taskType TaskType, label string, err error) {
+	tr.add("reject")
+}
+
+func TestTaskPool_Trace(t *testing.T) {
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	trace := &testTrace{statusMap: make(map[string]TaskStatus)}
+	taskPool.SetTrace(trace)
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return params, nil
+	})
+	taskPool.SetTaskHandlerFunc(taskTypeTestErr, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		if params["panic"] == true {
+			panic("boom")
+		}
+		return nil, errors.New("test error")
+	})
+	taskPool.AddTask(taskTypeTestEcho, "echo", nil)
+	taskPool.AddTask(taskTypeTestErr, "err", nil)
+	taskPool.AddTask(taskTypeTestErr, "panic", map[string]interface{}{"panic": true})
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if trace.count("submit") != 3 || trace.count("start") != 3 || trace.count("finish") != 3 || trace.count("panic") != 1 {
+		t.Errorf("Expected 3 submit/start/finish and 1 panic, got %v", trace.eventList)
+	}
+	if trace.statusMap["echo"] != TaskStatusSucceeded || trace.statusMap["err"] != TaskStatusFailed || trace.statusMap["panic"] != TaskStatusFailed {
+		t.Errorf("Expected finish status recorded, got %v", trace.statusMap)
+	}
+
+	//协程池关闭后提交被拒绝
+	pool, err := NewWorkerPool(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pool.Release()
+	taskPool.Clear(context.Background())
+	taskPool.SetWorkerPool(pool)
+	taskPool.AddTask(taskTypeTestEcho, "rejected", nil)
+	_ = taskPool.Start()
+	if trace.count("reject") != 1 {
+		t.Errorf("Expected 1 reject, got %v", trace.eventList)
+	}
+}
+
+func TestGetMetricCollectors(t *testing.T) {
+	pool, err := NewWorkerPool(8)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := RegisterWorkerPool("metric_test", pool); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer ReleaseWorkerPool("metric_test")
+
+	registry := prometheus.NewRegistry()
+	for _, collector := range GetMetricCollectors("test") {
+		registry.MustRegister(collector)
+	}
+
+	taskPool := GetTaskPool(context.Background())
+	defer taskPool.Release()
+	taskPool.SetTrace(&MetricTrace{})
+	taskPool.SetPoolSize(4)
+	taskPool.SetPoolName("metric_private")
+	taskPool.SetTaskHandlerFunc(taskTypeTestEcho, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	taskPool.AddTask(taskTypeTestEcho, "echo", nil)
+	if err := taskPool.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	capacity := func() map[string]float64 {
+		familyList, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		capacityMap := make(map[string]float64)
+		for _, family := range familyList {
+			if family.GetName() == "test_taskpool_pool_capacity" {
+				for _, metric := range family.GetMetric() {
+					capacityMap[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+		return capacityMap
+	}
+	//任务池自己的协程池也会上报, Release 后不再上报
+	if capacityMap := capacity(); capacityMap["metric_test"] != 8 || capacityMap["metric_private"] != 4 {
+		t.Errorf("Expected capacity of registered and private pools, got %v", capacityMap)
+	}
+	taskPool.Release()
+	if _, ok := capacity()["metric_private"]; ok {
+		t.Errorf("Expected private pool unregistered after release")
+	}
+
+	familyList, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	nameMap := make(map[string]bool)
+	for _, family := range familyList {
+		nameMap[family.GetName()] = true
+	}
+	for _, name := range []string{"test_taskpool_task", "test_taskpool_task_seconds", "test_taskpool_pool_running", "test_taskpool_pool_capacity"} {
+		if !nameMap[name] {
+			t.Errorf("Expected metric %s, got %v", name, nameMap)
+		}
+	}
+}
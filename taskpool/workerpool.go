@@ -0,0 +1,410 @@
+package taskpool
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"github.com/panjf2000/ants/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type WorkerPoolOption func(*workerPoolOptions)
+
+type workerPoolOptions struct {
+	nonblocking      bool
+	maxBlockingTasks int
+	expiryDuration   time.Duration
+	priorityQueue    bool
+}
+
+// WithNonblocking true 时协程池满了提交直接返回 ErrPoolOverload, false 时阻塞等待空闲协程
+func WithNonblocking(nonblocking bool) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.nonblocking = nonblocking
+	}
+}
+
+// WithMaxBlockingTasks 阻塞模式下最多等待的提交数, 0 表示不限制
+func WithMaxBlockingTasks(maxBlockingTasks int) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.maxBlockingTasks = maxBlockingTasks
+	}
+}
+
+// WithExpiryDuration 空闲协程的回收时间
+func WithExpiryDuration(expiryDuration time.Duration) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.expiryDuration = expiryDuration
+	}
+}
+
+// WithPriorityQueue 提交的任务先进入优先级队列, 有空闲协程时优先执行优先级高的, 同优先级先进先出
+// 共享协程池时避免大批量任务占满队列后交互类任务一直等待
+func WithPriorityQueue(priorityQueue bool) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.priorityQueue = priorityQueue
+	}
+}
+
+// WorkerPool 有容量上限的协程池, 可以被多个 TaskPool 共享
+type WorkerPool struct {
+	pool *ants.Pool
+	//nonblocking 按 busy 判断协程池是否已满, ants 协程池本身总是阻塞模式
+	nonblocking bool
+	//以下为优先级队列, priority 为 false 时不使用
+	priority bool
+	lock     sync.Mutex
+	cond     *sync.Cond
+	queue    priorityQueue
+	seq      uint64
+	inflight int
+	closed   bool
+	//dispatching 有任务排队时才启动分发协程, 队列空了退出
+	dispatching bool
+	//freeCh 有等待空闲协程的提交时创建, 任务结束或容量变化时关闭通知
+	freeLock sync.Mutex
+	freeCh   chan struct{}
+	//busy 通过 submit 提交还没结束的任务数, 非阻塞模式下不超过容量
+	busy atomic.Int32
+}
+
+func NewWorkerPool(size int, opts ...WorkerPoolOption) (*WorkerPool, error) {
+	op := workerPoolOptions{
+		nonblocking:    true,
+		expiryDuration: time.Hour,
+	}
+	for _, option := range opts {
+		option(&op)
+	}
+	if op.priorityQueue {
+		//由队列控制并发 提交到协程池时等待空闲协程
+		op.nonblocking = false
+	}
+	//非阻塞由 busy 控制, 任务刚结束协程还没放回时 ants 内部等待, 不会误判为已满
+	pool, err := ants.NewPool(size,
+		ants.WithNonblocking(false),
+		ants.WithMaxBlockingTasks(op.maxBlockingTasks),
+		ants.WithExpiryDuration(op.expiryDuration))
+	if err != nil {
+		return nil, err
+	}
+	w := &WorkerPool{pool: pool, nonblocking: op.nonblocking, priority: op.priorityQueue}
+	if w.priority {
+		w.cond = sync.NewCond(&w.lock)
+	}
+	return w, nil
+}
+
+// Submit 使用优先级队列时按优先级 0 提交
+func (w *WorkerPool) Submit(fn func()) error {
+	if w.priority {
+		return w.submitPriority(fn, 0, nil)
+	}
+	return w.submit(fn)
+}
+
+// SubmitWithPriority 优先级越大越先执行, 没有使用优先级队列时等同于 Submit
+func (w *WorkerPool) SubmitWithPriority(fn func(), priority int) error {
+	if !w.priority {
+		return w.submit(fn)
+	}
+	return w.submitPriority(fn, priority, nil)
+}
+
+// submit 非阻塞模式下协程池满了返回 ErrPoolOverload
+func (w *WorkerPool) submit(fn func()) error {
+	if !w.nonblocking {
+		w.busy.Add(1)
+	} else if !w.reserve() {
+		return ants.ErrPoolOverload
+	}
+	return w.submitReserved(fn)
+}
+
+// reserve 占用一个容量, 容量小于等于 0 时不限制
+func (w *WorkerPool) reserve() bool {
+	for {
+		busy := w.busy.Load()
+		if capacity := w.pool.Cap(); capacity > 0 && int(busy) >= capacity {
+			return false
+		}
+		if w.busy.CompareAndSwap(busy, busy+1) {
+			return true
+		}
+	}
+}
+
+// submitReserved 已占用容量, 任务结束后释放并通知等待的提交
+func (w *WorkerPool) submitReserved(fn func()) error {
+	err := w.pool.Submit(func() {
+		defer w.releaseBusy()
+		fn()
+	})
+	if err != nil {
+		w.releaseBusy()
+	}
+	return err
+}
+
+func (w *WorkerPool) releaseBusy() {
+	w.busy.Add(-1)
+	w.notifyFree()
+}
+
+// submitWait 协程池满了等到有任务结束后再提交, 不返回 ErrPoolOverload, ctx 取消后返回 ctx 的错误
+// 阻塞模式和优先级队列本身会等待, 直接提交
+func (w *WorkerPool) submitWait(ctx context.Context, fn func()) error {
+	if w.priority || !w.nonblocking {
+		return w.Submit(fn)
+	}
+	for {
+		//先拿到通知再占用容量, 避免占用失败后到等待前的任务结束被错过
+		freeCh := w.waitFree()
+		if w.reserve() {
+			return w.submitReserved(fn)
+		}
+		select {
+		case <-freeCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *WorkerPool) waitFree() <-chan struct{} {
+	w.freeLock.Lock()
+	defer w.freeLock.Unlock()
+	if w.freeCh == nil {
+		w.freeCh = make(chan struct{})
+	}
+	return w.freeCh
+}
+
+func (w *WorkerPool) notifyFree() {
+	w.freeLock.Lock()
+	defer w.freeLock.Unlock()
+	if w.freeCh != nil {
+		close(w.freeCh)
+		w.freeCh = nil
+	}
+}
+
+// submitPriority onReject 在任务出队后没能执行时调用, 比如协程池已关闭
+func (w *WorkerPool) submitPriority(fn func(), priority int, onReject func(err error)) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ants.ErrPoolClosed
+	}
+	w.seq++
+	heap.Push(&w.queue, &priorityTask{
+		fn:       fn,
+		priority: priority,
+		seq:      w.seq,
+		onReject: onReject,
+	})
+	if !w.dispatching {
+		w.dispatching = true
+		go w.dispatch()
+	}
+	w.cond.Signal()
+	return nil
+}
+
+// dispatch 有空闲协程时取出优先级最高的任务执行, 队列空了退出
+func (w *WorkerPool) dispatch() {
+	for {
+		w.lock.Lock()
+		//容量小于等于 0 时不限制
+		for !w.closed && len(w.queue) > 0 && w.pool.Cap() > 0 && w.inflight >= w.pool.Cap() {
+			w.cond.Wait()
+		}
+		if !w.closed && len(w.queue) == 0 {
+			w.dispatching = false
+			w.lock.Unlock()
+			return
+		}
+		if w.closed {
+			queue := w.queue
+			w.queue = nil
+			w.dispatching = false
+			w.lock.Unlock()
+			for _, item := range queue {
+				item.reject(ants.ErrPoolClosed)
+			}
+			return
+		}
+		item := heap.Pop(&w.queue).(*priorityTask)
+		w.inflight++
+		w.lock.Unlock()
+
+		if err := w.pool.Submit(func() {
+			defer w.done()
+			item.fn()
+		}); err != nil {
+			w.done()
+			item.reject(err)
+		}
+	}
+}
+
+func (w *WorkerPool) done() {
+	w.lock.Lock()
+	w.inflight--
+	w.lock.Unlock()
+	w.cond.Signal()
+}
+
+// Tune 修改容量, 运行中也生效
+func (w *WorkerPool) Tune(size int) {
+	w.pool.Tune(size)
+	if w.priority {
+		w.cond.Broadcast()
+	}
+	w.notifyFree()
+}
+
+func (w *WorkerPool) Cap() int {
+	return w.pool.Cap()
+}
+
+func (w *WorkerPool) Running() int {
+	return w.pool.Running()
+}
+
+func (w *WorkerPool) Free() int {
+	return w.pool.Free()
+}
+
+// Waiting 等待执行的任务数, 包括优先级队列中的
+func (w *WorkerPool) Waiting() int {
+	if w.priority {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		return w.pool.Waiting() + len(w.queue)
+	}
+	return w.pool.Waiting()
+}
+
+func (w *WorkerPool) IsClosed() bool {
+	return w.pool.IsClosed()
+}
+
+// Release 关闭协程池, 不等待执行中的任务, 优先级队列中的任务不再执行
+func (w *WorkerPool) Release() {
+	w.close()
+	w.pool.Release()
+	w.notifyFree()
+}
+
+// ReleaseTimeout 关闭协程池并等待执行中的任务结束
+func (w *WorkerPool) ReleaseTimeout(timeout time.Duration) error {
+	w.close()
+	defer w.notifyFree()
+	return w.pool.ReleaseTimeout(timeout)
+}
+
+func (w *WorkerPool) close() {
+	if !w.priority {
+		return
+	}
+	w.lock.Lock()
+	w.closed = true
+	w.lock.Unlock()
+	w.cond.Broadcast()
+}
+
+type priorityTask struct {
+	fn       func()
+	priority int
+	seq      uint64
+	onReject func(err error)
+}
+
+func (p *priorityTask) reject(err error) {
+	if p.onReject != nil {
+		p.onReject(err)
+	}
+}
+
+// priorityQueue 优先级高的在前, 同优先级按提交顺序
+type priorityQueue []*priorityTask
+
+func (q priorityQueue) Len() int {
+	return len(q)
+}
+
+func (q priorityQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q priorityQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *priorityQueue) Push(x interface{}) {
+	*q = append(*q, x.(*priorityTask))
+}
+
+func (q *priorityQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// defaultPoolName 默认共享的协程池在指标中的名字
+const defaultPoolName = "taskpool-default"
+
+// defaultPoolSize 默认共享的协程池大小, 也是自己的协程池没有设置大小时的大小
+const defaultPoolSize = 5000
+
+var defaultPool *WorkerPool
+var defaultPoolErr error
+var defaultPoolOnce = sync.Once{}
+
+// getDefaultWorkerPool 没有设置协程池的任务池共用, 不会关闭
+func getDefaultWorkerPool() (*WorkerPool, error) {
+	defaultPoolOnce.Do(func() {
+		defaultPool, defaultPoolErr = NewWorkerPool(defaultPoolSize, WithExpiryDuration(24*time.Hour))
+		if defaultPoolErr == nil {
+			privatePoolMap.Store(defaultPoolName, defaultPool)
+		}
+	})
+	return defaultPool, defaultPoolErr
+}
+
+var workerPoolMap = sync.Map{}
+
+// privatePoolMap 默认共享的协程池和任务池自己的协程池, 只用于采集指标, 不能通过 GetWorkerPool 获取
+var privatePoolMap = sync.Map{}
+
+// RegisterWorkerPool 注册命名的协程池, 不同 TaskPool 通过名字共享
+func RegisterWorkerPool(name string, pool *WorkerPool) error {
+	if _, loaded := workerPoolMap.LoadOrStore(name, pool); loaded {
+		return errors.New("worker pool already registered")
+	}
+	return nil
+}
+
+func GetWorkerPool(name string) (*WorkerPool, bool) {
+	v, ok := workerPoolMap.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*WorkerPool), true
+}
+
+// ReleaseWorkerPool 关闭并注销命名的协程池
+func ReleaseWorkerPool(name string) {
+	if v, loaded := workerPoolMap.LoadAndDelete(name); loaded {
+		v.(*WorkerPool).Release()
+	}
+}